@@ -0,0 +1,74 @@
+package debdiff
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/daaku/debdiff/alternatives"
+)
+
+// alternativeStatus is the JSON representation of a listed alternative.
+type alternativeStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Value  string `json:"value"`
+}
+
+// alternativesMain implements the "debdiff alternatives" subcommands.
+func alternativesMain(args []string) error {
+	if len(args) == 0 || args[0] != "list" {
+		return errors.New("usage: debdiff alternatives list [-status auto|manual] [-json]")
+	}
+
+	fs := flag.NewFlagSet("alternatives list", flag.ExitOnError)
+	status := fs.String("status", "", "only list alternatives with status auto or manual")
+	asJSON := fs.Bool("json", false, "output json")
+	fs.Parse(args[1:])
+
+	if *status != "" && *status != "auto" && *status != "manual" {
+		return errors.Errorf("invalid status %q, must be auto or manual", *status)
+	}
+
+	names, err := alternatives.GetSelections()
+	if err != nil {
+		return err
+	}
+
+	// only query when we need more than the names
+	if *status == "" && !*asJSON {
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return nil
+	}
+
+	all, err := alternatives.QueryAll(names)
+	if err != nil {
+		return err
+	}
+	list := make([]alternativeStatus, 0, len(all))
+	for _, qr := range all {
+		if *status != "" && qr.Status != *status {
+			continue
+		}
+		list = append(list, alternativeStatus{
+			Name:   qr.Name,
+			Status: qr.Status,
+			Value:  qr.Value,
+		})
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return errors.Wrap(enc.Encode(list), "error encoding json")
+	}
+	for _, a := range list {
+		fmt.Println(a.Name)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package debdiff
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/daaku/debdiff/alternatives"
+)
+
+// altState is the snapshotted state of an alternative.
+type altState struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Value  string `json:"value"`
+}
+
+// altDiff is a difference between the baseline and current alternatives.
+type altDiff struct {
+	Name     string    `json:"name"`
+	Baseline *altState `json:"baseline"`
+	Current  *altState `json:"current"`
+}
+
+func (d altDiff) String() string {
+	switch {
+	case d.Baseline == nil:
+		return fmt.Sprintf("+%s %s %s", d.Name, d.Current.Status, d.Current.Value)
+	case d.Current == nil:
+		return fmt.Sprintf("-%s %s %s", d.Name, d.Baseline.Status, d.Baseline.Value)
+	}
+	var changes []string
+	if d.Baseline.Status != d.Current.Status {
+		changes = append(changes, fmt.Sprintf("status %s -> %s",
+			d.Baseline.Status, d.Current.Status))
+	}
+	if d.Baseline.Value != d.Current.Value {
+		changes = append(changes, fmt.Sprintf("value %s -> %s",
+			d.Baseline.Value, d.Current.Value))
+	}
+	return fmt.Sprintf("%s: %s", d.Name, strings.Join(changes, ", "))
+}
+
+// snapshotAlternatives returns the current alternatives sorted by name.
+func (ad *DebDiff) snapshotAlternatives() ([]altState, error) {
+	selections, err := alternatives.GetSelections()
+	if err != nil {
+		return nil, err
+	}
+	all, err := alternatives.QueryAllN(selections, ad.jobs())
+	if err != nil {
+		return nil, err
+	}
+	res := make([]altState, 0, len(all))
+	for _, qr := range all {
+		res = append(res, altState{
+			Name:   qr.Name,
+			Status: qr.Status,
+			Value:  qr.Value,
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+// writeAltSnapshot writes tab separated "name status value" lines.
+func writeAltSnapshot(w io.Writer, states []altState) error {
+	bw := bufio.NewWriter(w)
+	for _, s := range states {
+		fmt.Fprintf(bw, "%s\t%s\t%s\n", s.Name, s.Status, s.Value)
+	}
+	return errors.Wrap(bw.Flush(), "writing alternatives snapshot")
+}
+
+func readAltSnapshot(path string) ([]altState, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading alternatives baseline")
+	}
+	defer f.Close()
+
+	var res []altState
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if sc.Text() == "" {
+			continue
+		}
+		parts := strings.SplitN(sc.Text(), "\t", 3)
+		if len(parts) != 3 {
+			return nil, errors.Errorf(
+				"invalid alternatives baseline line: %q", sc.Text())
+		}
+		res = append(res, altState{
+			Name:   parts[0],
+			Status: parts[1],
+			Value:  parts[2],
+		})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading alternatives baseline")
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+// diffAlternatives merges the two sorted snapshots.
+func diffAlternatives(baseline, current []altState) []altDiff {
+	var res []altDiff
+	for len(baseline) > 0 || len(current) > 0 {
+		switch {
+		case len(current) == 0 ||
+			len(baseline) > 0 && baseline[0].Name < current[0].Name:
+			res = append(res, altDiff{Name: baseline[0].Name, Baseline: &baseline[0]})
+			baseline = baseline[1:]
+		case len(baseline) == 0 || current[0].Name < baseline[0].Name:
+			res = append(res, altDiff{Name: current[0].Name, Current: &current[0]})
+			current = current[1:]
+		default:
+			if baseline[0] != current[0] {
+				res = append(res, altDiff{
+					Name:     current[0].Name,
+					Baseline: &baseline[0],
+					Current:  &current[0],
+				})
+			}
+			baseline = baseline[1:]
+			current = current[1:]
+		}
+	}
+	return res
+}
+
+// writeAltDiffJSON writes the alternatives differences with -format=json.
+// Baseline is null for an added alternative and Current for a removed one.
+func (ad *DebDiff) writeAltDiffJSON(w io.Writer) error {
+	out := struct {
+		AltDiff []altDiff `json:"alt_diff"`
+	}{AltDiff: ad.altDiff}
+	if out.AltDiff == nil {
+		out.AltDiff = []altDiff{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(out), "writing json")
+}
+
+// buildAltDiff snapshots the alternatives, optionally saving the snapshot and
+// comparing it against the baseline.
+func (ad *DebDiff) buildAltDiff(ctx context.Context) error {
+	if ad.AltBaseline == "" && ad.AltSave == "" {
+		return errors.New("-mode=alt-diff requires -alt-baseline or -alt-save")
+	}
+	current, err := ad.snapshotAlternatives()
+	if err != nil {
+		return err
+	}
+	if ad.AltSave != "" {
+		f, err := os.Create(ad.AltSave)
+		if err != nil {
+			return errors.Wrap(err, "writing alternatives snapshot")
+		}
+		if err := writeAltSnapshot(f, current); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return errors.Wrap(err, "writing alternatives snapshot")
+		}
+	}
+	if ad.AltBaseline == "" {
+		return nil
+	}
+	baseline, err := readAltSnapshot(ad.AltBaseline)
+	if err != nil {
+		return err
+	}
+	ad.altDiff = diffAlternatives(baseline, current)
+	return nil
+}
@@ -0,0 +1,68 @@
+package debdiff
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteAltDiffJSON(t *testing.T) {
+	cases := []struct {
+		name string
+		diff []altDiff
+		want string
+	}{
+		{"empty", nil, "{\n  \"alt_diff\": []\n}\n"},
+		{
+			"changed",
+			diffAlternatives(
+				[]altState{{Name: "editor", Status: "auto", Value: "/usr/bin/vim"}},
+				[]altState{{Name: "editor", Status: "manual", Value: "/usr/bin/nano"}}),
+			`{
+  "alt_diff": [
+    {
+      "name": "editor",
+      "baseline": {
+        "name": "editor",
+        "status": "auto",
+        "value": "/usr/bin/vim"
+      },
+      "current": {
+        "name": "editor",
+        "status": "manual",
+        "value": "/usr/bin/nano"
+      }
+    }
+  ]
+}
+`,
+		},
+		{
+			"added",
+			diffAlternatives(nil, []altState{{Name: "pager", Status: "auto", Value: "/bin/less"}}),
+			`{
+  "alt_diff": [
+    {
+      "name": "pager",
+      "baseline": null,
+      "current": {
+        "name": "pager",
+        "status": "auto",
+        "value": "/bin/less"
+      }
+    }
+  ]
+}
+`,
+		},
+	}
+	for _, c := range cases {
+		ad := &DebDiff{altDiff: c.diff}
+		var buf bytes.Buffer
+		if err := ad.writeAltDiffJSON(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != c.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", c.name, buf.String(), c.want)
+		}
+	}
+}
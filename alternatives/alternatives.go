@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"bytes"
 	"os/exec"
+	"runtime"
 
 	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
 )
 
 // GetSelections list master alternative names and their status.
@@ -64,6 +66,33 @@ func Query(name string) (QueryResult, error) {
 	return qr, nil
 }
 
+// QueryAll queries information about all the named groups concurrently. The
+// results are in the same order as names.
+func QueryAll(names []string) ([]QueryResult, error) {
+	return QueryAllN(names, runtime.NumCPU())
+}
+
+// QueryAllN is like QueryAll, but runs at most n queries at a time.
+func QueryAllN(names []string, n int) ([]QueryResult, error) {
+	if n < 1 {
+		n = 1
+	}
+	res := make([]QueryResult, len(names))
+	var g errgroup.Group
+	g.SetLimit(n)
+	for i := range names {
+		g.Go(func() error {
+			var err error
+			res[i], err = Query(names[i])
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
 var (
 	prefixName        = []byte("Name: ")
 	prefixLink        = []byte("Link: ")
@@ -0,0 +1,41 @@
+package debdiff
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/daaku/debdiff/alternatives"
+)
+
+// altOrphan is an alternative whose selected value isn't owned by any package.
+type altOrphan struct {
+	Name  string
+	Value string
+}
+
+func (a altOrphan) String() string {
+	return fmt.Sprintf("%s -> %s (unowned path)", a.Name, a.Value)
+}
+
+// buildAltOrphans finds the alternatives pointing at paths that no installed
+// package provides, usually because the providing package was removed.
+func (ad *DebDiff) buildAltOrphans(ctx context.Context) error {
+	selections, err := alternatives.GetSelections()
+	if err != nil {
+		return err
+	}
+	all, err := alternatives.QueryAllN(selections, ad.jobs())
+	if err != nil {
+		return err
+	}
+	for _, qr := range all {
+		if qr.Value == "" || ad.has(ad.pkgFile, qr.Value) {
+			continue
+		}
+		ad.altOrphan = append(ad.altOrphan, altOrphan{
+			Name:  qr.Name,
+			Value: qr.Value,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package debdiff
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// applyRepoFiles copies the differing and missing repo files onto the root,
+// first backing up the existing files into the BackupDir if one is set. Unless
+// Yes is set only the copies that would be made are printed.
+func (ad *DebDiff) applyRepoFiles(w io.Writer) error {
+	files := append(append([]string(nil), ad.diffRepoFile...), ad.repoOnlyFile...)
+	created := make(stringSet)
+	for _, file := range files {
+		src := ad.repoPath(file)
+		dst := ad.rootPath(file)
+		if err := ad.backupFile(w, file, dst); err != nil {
+			return err
+		}
+		if err := ad.makeParents(w, file, created); err != nil {
+			return err
+		}
+		if !ad.Yes {
+			ad.emit(w, fmt.Sprintf("would copy %s to %s", src, dst))
+			continue
+		}
+		if err := copyPath(src, dst); err != nil {
+			return err
+		}
+		ad.emit(w, fmt.Sprintf("copied %s to %s", src, dst))
+	}
+	return nil
+}
+
+// makeParents creates the directories missing from the root above the repo
+// file, with the modes of the repo directories. The created directories are
+// added to created, which also covers those that would be created.
+func (ad *DebDiff) makeParents(w io.Writer, file string, created stringSet) error {
+	// the missing root directories and the matching repo directories
+	var missing, repoDirs []string
+	repoDir := filepath.Dir(ad.repoPath(file))
+	for dir := filepath.Dir(file); dir != "/" && dir != "."; dir = filepath.Dir(dir) {
+		path := ad.rootPath(dir)
+		if created.Contains(path) {
+			break
+		}
+		if _, err := os.Lstat(path); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return errors.Wrap(err, "applying repo file")
+		}
+		missing = append(missing, path)
+		repoDirs = append(repoDirs, repoDir)
+		repoDir = filepath.Dir(repoDir)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		info, err := os.Stat(repoDirs[i])
+		if err != nil {
+			return errors.Wrap(err, "applying repo file")
+		}
+		path := missing[i]
+		created[path] = struct{}{}
+		if !ad.Yes {
+			ad.emit(w, fmt.Sprintf("would create %s", path))
+			continue
+		}
+		if err := os.Mkdir(path, info.Mode().Perm()); err != nil {
+			return errors.Wrap(err, "applying repo file")
+		}
+		// the umask applies on creation
+		if err := os.Chmod(path, info.Mode().Perm()); err != nil {
+			return errors.Wrap(err, "applying repo file")
+		}
+		ad.emit(w, fmt.Sprintf("created %s", path))
+	}
+	return nil
+}
+
+// backupFile copies the root file at path into the BackupDir, at the same path
+// relative to the root. Files that do not exist are not backed up.
+func (ad *DebDiff) backupFile(w io.Writer, file, path string) error {
+	if ad.BackupDir == "" {
+		return nil
+	}
+	if _, err := os.Lstat(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "backing up root file")
+	}
+	backup := filepath.Join(ad.BackupDir, file)
+	if !ad.Yes {
+		ad.emit(w, fmt.Sprintf("would back up %s to %s", path, backup))
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(backup), 0755); err != nil {
+		return errors.Wrap(err, "backing up root file")
+	}
+	if err := copyPath(path, backup); err != nil {
+		return err
+	}
+	ad.emit(w, fmt.Sprintf("backed up %s to %s", path, backup))
+	return nil
+}
+
+// copyPath replaces dst with a copy of src, which may be a symlink. The copy is
+// made next to dst and renamed over it, so dst is never partially written.
+func copyPath(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return errors.Wrap(err, "applying repo file")
+	}
+	tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".debdiff")
+	os.Remove(tmp)
+	if isSymlink(info) {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return errors.Wrap(err, "applying repo file")
+		}
+		if err := os.Symlink(target, tmp); err != nil {
+			return errors.Wrap(err, "applying repo file")
+		}
+	} else if err := copyFileMode(src, tmp, info.Mode().Perm()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "applying repo file")
+	}
+	return nil
+}
+
+// copyFileMode copies the contents of src to the new file dst with perm.
+func copyFileMode(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return errors.Wrap(err, "applying repo file")
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return errors.Wrap(err, "applying repo file")
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return errors.Wrap(err, "applying repo file")
+	}
+	if err := out.Close(); err != nil {
+		return errors.Wrap(err, "applying repo file")
+	}
+	// the umask applies on creation
+	return errors.Wrap(os.Chmod(dst, perm), "applying repo file")
+}
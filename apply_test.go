@@ -0,0 +1,52 @@
+package debdiff
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyRepoOnlyFile(t *testing.T) {
+	ad := testDebDiff(t,
+		map[string]string{"etc/a": "old"},
+		map[string]string{"etc/a": "new", "etc/new/sub/b": "b"})
+	if err := os.Chmod(filepath.Join(ad.Repo, "etc", "new"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ad.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	var dry bytes.Buffer
+	if err := ad.applyRepoFiles(&dry); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(dry.Bytes(), []byte("would create "+filepath.Join(ad.Root, "etc", "new", "sub"))) {
+		t.Fatalf("dry run does not create the directories:\n%s", dry.String())
+	}
+	if _, err := os.Lstat(filepath.Join(ad.Root, "etc", "new")); !os.IsNotExist(err) {
+		t.Fatalf("dry run created a directory: %v", err)
+	}
+
+	ad.Yes = true
+	if err := ad.applyRepoFiles(&bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"etc/a": "new", "etc/new/sub/b": "b"} {
+		got, err := os.ReadFile(filepath.Join(ad.Root, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Fatalf("%s: got %q, want %q", name, got, want)
+		}
+	}
+	info, err := os.Stat(filepath.Join(ad.Root, "etc", "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Fatalf("created directory has mode %v, want 0700", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,63 @@
+// Package aptmark provides access to the apt-mark package states.
+package aptmark // import "github.com/daaku/debdiff/aptmark"
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Mark is a package state managed by apt-mark.
+type Mark string
+
+const (
+	// Hold marks packages that will not be upgraded or removed.
+	Hold Mark = "hold"
+	// Auto marks packages installed as dependencies.
+	Auto Mark = "auto"
+	// Manual marks packages installed explicitly.
+	Manual Mark = "manual"
+)
+
+// Valid reports if m is a known mark.
+func (m Mark) Valid() bool {
+	return m == Hold || m == Auto || m == Manual
+}
+
+// Show lists the packages with the given mark, sorted by name.
+func Show(m Mark) ([]string, error) {
+	return ShowRoot("/", m)
+}
+
+// ShowRoot is Show for the system installed under root, using the apt and
+// dpkg state found there.
+func ShowRoot(root string, m Mark) ([]string, error) {
+	if !m.Valid() {
+		return nil, errors.Errorf("invalid mark %q", m)
+	}
+	var args []string
+	if root != "" && root != "/" {
+		args = append(args,
+			"-o", "Dir="+root,
+			"-o", "Dir::State::status="+filepath.Join(root, "var/lib/dpkg/status"))
+	}
+	args = append(args, "show"+string(m))
+	out, err := exec.Command("apt-mark", args...).Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error showing %s packages", m)
+	}
+
+	var res []string
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		res = append(res, string(line))
+	}
+	sort.Strings(res)
+	return res, nil
+}
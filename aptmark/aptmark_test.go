@@ -0,0 +1,62 @@
+package aptmark
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testStatus = `Package: fake-a
+Status: install ok installed
+Architecture: all
+Version: 1.0
+Maintainer: Test <test@example.com>
+Description: a
+
+Package: fake-b
+Status: hold ok installed
+Architecture: all
+Version: 1.0
+Maintainer: Test <test@example.com>
+Description: b
+
+`
+
+func TestShowRoot(t *testing.T) {
+	if _, err := exec.LookPath("apt-mark"); err != nil {
+		t.Skip("apt-mark is not available")
+	}
+	root := t.TempDir()
+	files := map[string]string{
+		"var/lib/dpkg/status":         testStatus,
+		"var/lib/apt/extended_states": "Package: fake-a\nArchitecture: all\nAuto-Installed: 1\n\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cases := []struct {
+		mark Mark
+		want []string
+	}{
+		{Auto, []string{"fake-a"}},
+		{Manual, []string{"fake-b"}},
+		{Hold, []string{"fake-b"}},
+	}
+	for _, c := range cases {
+		got, err := ShowRoot(root, c.mark)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.mark, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package debdiff
+
+import (
+	"os"
+	"syscall"
+)
+
+// diskUsage returns the space allocated for the file, which accounts for
+// sparse files and file system block sizes.
+func diskUsage(info os.FileInfo) int64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Blocks * 512
+	}
+	return info.Size()
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package debdiff
+
+import "os"
+
+// diskUsage returns the apparent size as block usage is only supported on
+// linux.
+func diskUsage(info os.FileInfo) int64 {
+	return info.Size()
+}
@@ -0,0 +1,26 @@
+package debdiff
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// birthTime returns the creation time of path, and false if the file system
+// doesn't report it.
+func birthTime(path string) (time.Time, bool, error) {
+	var stx unix.Statx_t
+	err := unix.Statx(unix.AT_FDCWD, path, unix.AT_SYMLINK_NOFOLLOW,
+		unix.STATX_BTIME, &stx)
+	if err != nil {
+		if err == unix.ENOSYS {
+			return time.Time{}, false, nil
+		}
+		return time.Time{}, false, errors.Wrapf(err, "statx %s", path)
+	}
+	if stx.Mask&unix.STATX_BTIME == 0 {
+		return time.Time{}, false, nil
+	}
+	return time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec)), true, nil
+}
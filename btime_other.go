@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package debdiff
+
+import "time"
+
+// birthTime returns false as creation times are only supported on linux.
+func birthTime(path string) (time.Time, bool, error) {
+	return time.Time{}, false, nil
+}
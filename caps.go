@@ -0,0 +1,320 @@
+package debdiff
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// capNames are the capability names, indexed by their number.
+var capNames = []string{
+	"cap_chown",
+	"cap_dac_override",
+	"cap_dac_read_search",
+	"cap_fowner",
+	"cap_fsetid",
+	"cap_kill",
+	"cap_setgid",
+	"cap_setuid",
+	"cap_setpcap",
+	"cap_linux_immutable",
+	"cap_net_bind_service",
+	"cap_net_broadcast",
+	"cap_net_admin",
+	"cap_net_raw",
+	"cap_ipc_lock",
+	"cap_ipc_owner",
+	"cap_sys_module",
+	"cap_sys_rawio",
+	"cap_sys_chroot",
+	"cap_sys_ptrace",
+	"cap_sys_pacct",
+	"cap_sys_admin",
+	"cap_sys_boot",
+	"cap_sys_nice",
+	"cap_sys_resource",
+	"cap_sys_time",
+	"cap_sys_tty_config",
+	"cap_mknod",
+	"cap_lease",
+	"cap_audit_write",
+	"cap_audit_control",
+	"cap_setfcap",
+	"cap_mac_override",
+	"cap_mac_admin",
+	"cap_syslog",
+	"cap_wake_alarm",
+	"cap_block_suspend",
+	"cap_audit_read",
+	"cap_perfmon",
+	"cap_bpf",
+	"cap_checkpoint_restore",
+}
+
+// The layout of the security.capability xattr, see linux/capability.h.
+const (
+	vfsCapRevisionMask = 0xFF000000
+	vfsCapRevision1    = 0x01000000
+	vfsCapRevision2    = 0x02000000
+	vfsCapRevision3    = 0x03000000
+	vfsCapFlagsEffect  = 0x000001
+)
+
+// fileCaps maps capability names to their flags, some of "eip".
+type fileCaps map[string]string
+
+func (c fileCaps) String() string {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + "=" + c[name]
+	}
+	return strings.Join(names, ",")
+}
+
+// decodeCaps decodes the security.capability xattr value.
+func decodeCaps(data []byte) (fileCaps, error) {
+	if len(data) < 4 {
+		return nil, errors.Errorf("capability data too short: %d bytes", len(data))
+	}
+	magic := binary.LittleEndian.Uint32(data)
+	var words int
+	switch magic & vfsCapRevisionMask {
+	case vfsCapRevision1:
+		words = 1
+	case vfsCapRevision2, vfsCapRevision3:
+		words = 2
+	default:
+		return nil, errors.Errorf("unknown capability revision 0x%x", magic)
+	}
+	if len(data) < 4+words*8 {
+		return nil, errors.Errorf("capability data too short: %d bytes", len(data))
+	}
+	var permitted, inheritable uint64
+	for i := 0; i < words; i++ {
+		off := 4 + i*8
+		permitted |= uint64(binary.LittleEndian.Uint32(data[off:])) << (32 * uint(i))
+		inheritable |= uint64(binary.LittleEndian.Uint32(data[off+4:])) << (32 * uint(i))
+	}
+	caps := make(fileCaps)
+	for bit := uint(0); bit < 64; bit++ {
+		var flags string
+		if magic&vfsCapFlagsEffect != 0 && permitted&(1<<bit) != 0 {
+			flags += "e"
+		}
+		if inheritable&(1<<bit) != 0 {
+			flags += "i"
+		}
+		if permitted&(1<<bit) != 0 {
+			flags += "p"
+		}
+		if flags == "" {
+			continue
+		}
+		name := fmt.Sprintf("cap_%d", bit)
+		if int(bit) < len(capNames) {
+			name = capNames[bit]
+		}
+		caps[name] = flags
+	}
+	return caps, nil
+}
+
+// parseCaps parses the textual form used by getcap, either the newer
+// "cap_a,cap_b=ep" or the older "= cap_a,cap_b+ep".
+func parseCaps(s string) fileCaps {
+	caps := make(fileCaps)
+	for _, clause := range strings.Fields(s) {
+		if clause == "=" {
+			continue
+		}
+		i := strings.IndexAny(clause, "=+")
+		names, flags := clause, ""
+		if i > -1 {
+			names, flags = clause[:i], clause[i+1:]
+		}
+		for _, name := range strings.Split(names, ",") {
+			if name != "" {
+				caps[strings.ToLower(name)] = sortFlags(flags)
+			}
+		}
+	}
+	return caps
+}
+
+// sortFlags puts the flags in a canonical order.
+func sortFlags(flags string) string {
+	var res string
+	for _, f := range "eip" {
+		if strings.ContainsRune(flags, f) {
+			res += string(f)
+		}
+	}
+	return res
+}
+
+// capsDiff is a file whose capabilities differ from the baseline.
+type capsDiff struct {
+	Path    string
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+func (c capsDiff) String() string {
+	parts := []string{c.Path}
+	if len(c.Added) > 0 {
+		parts = append(parts, "added="+strings.Join(c.Added, ","))
+	}
+	if len(c.Removed) > 0 {
+		parts = append(parts, "removed="+strings.Join(c.Removed, ","))
+	}
+	if len(c.Changed) > 0 {
+		parts = append(parts, "changed="+strings.Join(c.Changed, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+func compareCaps(path string, expected, actual fileCaps) (capsDiff, bool) {
+	d := capsDiff{Path: path}
+	for name, flags := range actual {
+		e, ok := expected[name]
+		if !ok {
+			d.Added = append(d.Added, name)
+		} else if e != flags {
+			d.Changed = append(d.Changed, name)
+		}
+	}
+	for name := range expected {
+		if _, ok := actual[name]; !ok {
+			d.Removed = append(d.Removed, name)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Strings(d.Changed)
+	return d, len(d.Added)+len(d.Removed)+len(d.Changed) > 0
+}
+
+// readCapsBaseline reads a file of "path caps" lines, as output by getcap.
+func (ad *DebDiff) readCapsBaseline() (map[string]fileCaps, error) {
+	f, err := os.Open(ad.CapsFrom)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading capabilities baseline")
+	}
+	defer f.Close()
+
+	res := make(map[string]fileCaps)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		l := strings.TrimSpace(sc.Text())
+		if len(l) == 0 || l[0] == '#' {
+			continue
+		}
+		i := strings.IndexByte(l, ' ')
+		if i == -1 {
+			return nil, errors.Errorf("invalid capabilities line: %q", l)
+		}
+		res[filepath.Join("/", l[:i])] = parseCaps(l[i+1:])
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading capabilities baseline")
+	}
+	return res, nil
+}
+
+// lostCaps reports if a baseline file that was not walked is missing or has
+// no capabilities. A file that has capabilities was skipped by the walk, so is
+// returned as an error.
+func (ad *DebDiff) lostCaps(path string) (bool, error) {
+	if _, err := os.Lstat(ad.rootPath(path)); err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, errors.Wrap(err, "checking capabilities")
+	}
+	data, err := getCapability(ad.rootPath(path))
+	if err != nil {
+		return false, err
+	}
+	if data != nil {
+		return false, errors.Errorf("%s was not walked, not comparing its capabilities", path)
+	}
+	return true, nil
+}
+
+// buildCapsDiff compares the capabilities of all the walked files against the
+// CapsFrom baseline.
+func (ad *DebDiff) buildCapsDiff(ctx context.Context) error {
+	if ad.CapsFrom == "" {
+		return nil
+	}
+	baseline, err := ad.readCapsBaseline()
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, path := range ad.allFile {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data, err := getCapability(ad.rootPath(path))
+		if err != nil {
+			if os.IsPermission(errors.Cause(err)) {
+				ad.skip(err)
+				seen[path] = true
+				continue
+			}
+			return err
+		}
+		expected := baseline[path]
+		if data == nil && expected == nil {
+			continue
+		}
+		seen[path] = true
+		actual := fileCaps{}
+		if data != nil {
+			if actual, err = decodeCaps(data); err != nil {
+				return errors.Wrapf(err, "decoding capabilities of %s", path)
+			}
+		}
+		if d, ok := compareCaps(path, expected, actual); ok {
+			ad.capsDiff = append(ad.capsDiff, d)
+		}
+	}
+	// baseline files that were not walked have lost their capabilities if
+	// they are missing or have none, unless they are ignored
+	for path, expected := range baseline {
+		if seen[path] {
+			continue
+		}
+		if rule, _ := ad.ignoredWithin(path); rule != nil {
+			continue
+		}
+		lost, err := ad.lostCaps(path)
+		if err != nil {
+			ad.skip(err)
+			continue
+		}
+		if !lost {
+			continue
+		}
+		if d, ok := compareCaps(path, expected, fileCaps{}); ok {
+			ad.capsDiff = append(ad.capsDiff, d)
+		}
+	}
+	sort.Slice(ad.capsDiff, func(i, j int) bool {
+		return ad.capsDiff[i].Path < ad.capsDiff[j].Path
+	})
+	return nil
+}
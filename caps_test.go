@@ -0,0 +1,35 @@
+package debdiff
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCapsDiffNotWalked(t *testing.T) {
+	ad := testDebDiff(t,
+		map[string]string{"etc/plain": "p", "opt/skipped": "s"},
+		nil, "/etc")
+	ad.CapsFrom = filepath.Join(t.TempDir(), "caps")
+	ad.SkipDirs = []string{"/opt"}
+	baseline := "/etc/plain cap_net_raw=ep\n" +
+		"/etc/missing cap_net_raw=ep\n" +
+		"/opt/skipped cap_net_raw=ep\n" +
+		"/var/lib/dpkg/ignored cap_net_raw=ep\n"
+	if err := os.WriteFile(ad.CapsFrom, []byte(baseline), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ad.Run(); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range ad.capsDiff {
+		got = append(got, d.Path)
+	}
+	// the ignored file is not reported, the skipped one has no capabilities
+	want := []string{"/etc/missing", "/etc/plain", "/opt/skipped"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,19 @@
+// Command debdiff is the command line interface to package debdiff.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/daaku/debdiff"
+)
+
+func main() {
+	if err := debdiff.Main(); err != nil {
+		if err == debdiff.ErrDifferences {
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "%+v", err)
+		os.Exit(1)
+	}
+}
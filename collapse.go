@@ -0,0 +1,68 @@
+package debdiff
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// unpackagedLines returns the unpackaged files to print. With CollapseDirs
+// a directory containing only unpackaged files is reported once in their
+// place, with a trailing slash.
+func (ad *DebDiff) unpackagedLines() []string {
+	if !ad.CollapseDirs {
+		return ad.unpackagedFile
+	}
+
+	// the directories containing something that is not unpackaged
+	unpackaged := newStringSet(ad.unpackagedFile)
+	known := make(stringSet)
+	mark := func(file string) {
+		for p := file; !known.Contains(p); p = filepath.Dir(p) {
+			known[p] = struct{}{}
+			if p == filepath.Dir(p) {
+				break
+			}
+		}
+	}
+	for _, files := range [][]string{ad.pkgFile, ad.repoFile, ad.alternateFile} {
+		for _, file := range files {
+			mark(file)
+		}
+	}
+	for _, file := range ad.allFile {
+		if !unpackaged.Contains(file) {
+			mark(file)
+		}
+	}
+
+	var res []string
+	seen := make(stringSet)
+	for _, file := range ad.unpackagedFile {
+		// the root itself is never collapsed
+		top := file
+		for {
+			dir := filepath.Dir(top)
+			if dir == "/" || dir == top || known.Contains(dir) {
+				break
+			}
+			top = dir
+		}
+		if top != file {
+			top += "/"
+		}
+		if !seen.Contains(top) {
+			seen[top] = struct{}{}
+			res = append(res, top)
+		}
+	}
+	return res
+}
+
+// displayUnpackaged is display for an unpackaged line, keeping the trailing
+// slash of a collapsed directory.
+func (ad *DebDiff) displayUnpackaged(file string) string {
+	if dir := strings.TrimSuffix(file, "/"); dir != file {
+		return ad.display(dir) + "/"
+	}
+	return ad.display(file)
+}
@@ -0,0 +1,48 @@
+package debdiff
+
+import (
+	"io"
+	"os"
+)
+
+// The Color settings, auto only colors terminals and respects NO_COLOR.
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// The escape sequences used for the categories of files.
+const (
+	colorUnpackaged = "\x1b[32m"
+	colorModified   = "\x1b[33m"
+	colorMissing    = "\x1b[31m"
+	colorReset      = "\x1b[0m"
+)
+
+// useColor reports if the output to w should be colored.
+func (ad *DebDiff) useColor(w io.Writer) bool {
+	switch ad.Color {
+	case colorAlways:
+		return true
+	case colorAuto:
+		if os.Getenv("NO_COLOR") != "" {
+			return false
+		}
+		f, ok := w.(*os.File)
+		if !ok {
+			return false
+		}
+		info, err := f.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0
+	}
+	return false
+}
+
+// colorize wraps the line in the color when coloring is enabled.
+func (ad *DebDiff) colorize(color, line string) string {
+	if !ad.colored || color == "" {
+		return line
+	}
+	return color + line + colorReset
+}
@@ -0,0 +1,85 @@
+package debdiff
+
+import (
+	"bufio"
+	"crypto/md5"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// dpkgStatusFile returns the path to the dpkg status database.
+func (ad *DebDiff) dpkgStatusFile() string {
+	return filepath.Join(ad.Root, "var/lib/dpkg/status")
+}
+
+// readConffiles reads the md5 sums dpkg recorded for the conffiles of the
+// installed packages from the status database.
+func readConffiles(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading dpkg status")
+	}
+	defer f.Close()
+
+	res := make(map[string]string)
+	var inConffiles bool
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		l := sc.Text()
+		if !strings.HasPrefix(l, " ") {
+			inConffiles = strings.HasPrefix(l, "Conffiles:")
+			continue
+		}
+		if !inConffiles {
+			continue
+		}
+		// lines are " /path sum [obsolete]"
+		fields := strings.Fields(l)
+		if len(fields) < 2 || len(fields[1]) != md5.Size*2 {
+			continue
+		}
+		res[fields[0]] = fields[1]
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading dpkg status")
+	}
+	return res, nil
+}
+
+// excludeUnchangedConffiles removes the differing repo files that are
+// conffiles still identical to what their package shipped, leaving only the
+// ones that have been edited.
+func (ad *DebDiff) excludeUnchangedConffiles() error {
+	if !ad.ExcludeUnchangedConffiles || len(ad.diffRepoFile) == 0 {
+		return nil
+	}
+	conffiles, err := readConffiles(ad.dpkgStatusFile())
+	if err != nil {
+		return err
+	}
+
+	res := ad.diffRepoFile[:0]
+	for _, file := range ad.diffRepoFile {
+		expected, ok := conffiles[file]
+		if !ok {
+			res = append(res, file)
+			continue
+		}
+		path := ad.rootPath(file)
+		actual, err := hashFile(md5.New, path)
+		if err != nil {
+			ad.skip(err)
+			res = append(res, file)
+			continue
+		}
+		if actual != expected {
+			res = append(res, file)
+		}
+	}
+	ad.diffRepoFile = res
+	return nil
+}
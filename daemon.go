@@ -0,0 +1,173 @@
+package debdiff
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// daemonStatus is the outcome of the latest daemon run.
+type daemonStatus struct {
+	Time       time.Time      `json:"time"`
+	Duration   float64        `json:"duration_seconds"`
+	Error      string         `json:"error,omitempty"`
+	Counts     map[string]int `json:"counts"`
+	Unpackaged []string       `json:"unpackaged"`
+	DiffRepo   []string       `json:"diff_repo"`
+	Runs       int            `json:"runs"`
+	Errors     int            `json:"errors"`
+}
+
+// daemon serves the latest status over http.
+type daemon struct {
+	mu     sync.Mutex
+	status daemonStatus
+	logf   func(format string, v ...interface{})
+}
+
+// runDaemon runs the phases every DaemonInterval until SIGTERM or SIGINT,
+// serving the latest result on DaemonAddr. File hashes are cached between
+// runs, in the HashCache if set or otherwise in memory, so each run only
+// hashes the files that changed.
+func (ad *DebDiff) runDaemon(phases []phase) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(sig)
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// listen first so an unusable address fails before the first run
+	ln, err := net.Listen("tcp", ad.DaemonAddr)
+	if err != nil {
+		return errors.Wrap(err, "serving daemon status")
+	}
+	d := &daemon{logf: ad.logf}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", d.serveStatus)
+	mux.HandleFunc("/metrics", d.serveMetrics)
+	srv := &http.Server{Addr: ad.DaemonAddr, Handler: mux}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ln) }()
+
+	ticker := time.NewTicker(ad.DaemonInterval)
+	defer ticker.Stop()
+	for {
+		start := time.Now()
+		err := ad.runOnce(ctx, phases)
+		d.update(ad, start, err)
+		select {
+		case <-ticker.C:
+		case err := <-served:
+			return errors.Wrap(err, "serving daemon status")
+		case <-ctx.Done():
+			shutdown, done := context.WithTimeout(context.Background(), 10*time.Second)
+			defer done()
+			return errors.Wrap(srv.Shutdown(shutdown), "shutting down daemon")
+		}
+	}
+}
+
+// runOnce runs the phases from a clean state.
+func (ad *DebDiff) runOnce(ctx context.Context, phases []phase) error {
+	ad.reset()
+	err := ad.processTimeout(ctx, phases)
+	if err == nil {
+		err = ad.collected()
+	}
+	if err != nil && ctx.Err() == nil && !ad.Silent {
+		ad.logf("Run failed: %s", err)
+	}
+	// each run is held back on its own
+	if ad.held != nil {
+		if err == nil && ad.findings() == 0 {
+			ad.held.discard()
+		} else {
+			ad.held.flush()
+		}
+		ad.held.start()
+	}
+	return err
+}
+
+func (d *daemon) update(ad *DebDiff, start time.Time, err error) {
+	status := daemonStatus{
+		Time:       time.Now().UTC(),
+		Duration:   time.Since(start).Seconds(),
+		Counts:     make(map[string]int, len(metrics)),
+		Unpackaged: ad.unpackagedFile,
+		DiffRepo:   ad.diffRepoFile,
+	}
+	for name, metric := range metrics {
+		status.Counts[name] = metric(ad)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status.Runs = d.status.Runs + 1
+	status.Errors = d.status.Errors
+	if err != nil {
+		status.Error = err.Error()
+		status.Errors++
+	}
+	d.status = status
+}
+
+func (d *daemon) current() daemonStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.status
+}
+
+func (d *daemon) serveStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(d.current()); err != nil {
+		d.logf("Writing status: %s", err)
+	}
+}
+
+func (d *daemon) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	status := d.current()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	names := make([]string, 0, len(status.Counts))
+	for name := range status.Counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(w, "# HELP debdiff_files Number of files in each result category.")
+	fmt.Fprintln(w, "# TYPE debdiff_files gauge")
+	for _, name := range names {
+		fmt.Fprintf(w, "debdiff_files{category=%q} %d\n", name, status.Counts[name])
+	}
+	fmt.Fprintln(w, "# HELP debdiff_runs_total Number of completed runs.")
+	fmt.Fprintln(w, "# TYPE debdiff_runs_total counter")
+	fmt.Fprintf(w, "debdiff_runs_total %d\n", status.Runs)
+	fmt.Fprintln(w, "# HELP debdiff_run_errors_total Number of runs that failed.")
+	fmt.Fprintln(w, "# TYPE debdiff_run_errors_total counter")
+	fmt.Fprintf(w, "debdiff_run_errors_total %d\n", status.Errors)
+	if status.Time.IsZero() {
+		return
+	}
+	fmt.Fprintln(w, "# HELP debdiff_last_run_timestamp_seconds When the last run completed.")
+	fmt.Fprintln(w, "# TYPE debdiff_last_run_timestamp_seconds gauge")
+	fmt.Fprintf(w, "debdiff_last_run_timestamp_seconds %d\n", status.Time.Unix())
+	fmt.Fprintln(w, "# HELP debdiff_last_run_duration_seconds How long the last run took.")
+	fmt.Fprintln(w, "# TYPE debdiff_last_run_duration_seconds gauge")
+	fmt.Fprintf(w, "debdiff_last_run_duration_seconds %g\n", status.Duration)
+}
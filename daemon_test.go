@@ -0,0 +1,65 @@
+package debdiff
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDaemonAddrInUse(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	ad := &DebDiff{Daemon: true, DaemonAddr: ln.Addr().String(), DaemonInterval: time.Hour}
+	// the phases would block the first run
+	block := phase{func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+	err = ad.runDaemon([]phase{block})
+	if err == nil || !strings.Contains(err.Error(), "address already in use") {
+		t.Fatalf("got error %v, want the address in use", err)
+	}
+}
+
+func TestDaemonHashCache(t *testing.T) {
+	ad := testDebDiff(t, map[string]string{"etc/a": "old"}, map[string]string{"etc/a": "new"})
+	ad.Daemon = true
+	phases, err := ad.modePhases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := ad.runOnce(ctx, phases); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/etc/a"}; !reflect.DeepEqual(ad.diffRepoFile, want) {
+		t.Fatalf("got %v, want %v", ad.diffRepoFile, want)
+	}
+
+	// a change that keeps the size and mtime is only seen by hashing again
+	path := filepath.Join(ad.Root, "etc", "a")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if err := ad.runOnce(ctx, phases); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/etc/a"}; !reflect.DeepEqual(ad.diffRepoFile, want) {
+		t.Fatalf("the second run hashed again, got %v", ad.diffRepoFile)
+	}
+}
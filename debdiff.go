@@ -1,29 +1,41 @@
-// Command debdiff implements a tool to view and manipulate a "system
+// Package debdiff implements a tool to view and manipulate a "system
 // level diff" of sorts for apt/dpkg based systems. It's somewhat akin to the
 // "things that differ" if a new system was given the exact current set of
 // packages combined with a target directory that can be considered an
 // "overlay" on top of the packages for things like configuration and or
 // ignored data.
-package main // import "github.com/daaku/debdiff"
+package debdiff // import "github.com/daaku/debdiff"
 
-// TODO: pkg files that are missing
 // TODO: config files that are modified
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
 	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
 	"flag"
 	"fmt"
+	"hash"
 	"io"
+	"io/fs"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"runtime/pprof"
 	"sort"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 
 	"github.com/gobwas/glob"
 	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/norm"
 
 	"github.com/daaku/debdiff/alternatives"
 )
@@ -32,6 +44,31 @@ type Glob interface {
 	Match(name string) bool
 }
 
+// ignoreRule is a compiled ignore pattern along with where it came from.
+type ignoreRule struct {
+	Glob
+	Pattern string
+	Source  string
+	Line    int
+
+	// Fold is set for case-insensitive patterns, which are compiled lowercased.
+	Fold bool
+}
+
+// ignoreFoldPrefix marks an individual pattern as case-insensitive.
+const ignoreFoldPrefix = "i:"
+
+func (r ignoreRule) Match(path string) bool {
+	if r.Fold {
+		path = strings.ToLower(path)
+	}
+	return r.Glob.Match(path)
+}
+
+func (r ignoreRule) String() string {
+	return fmt.Sprintf("%q (%s:%d)", r.Pattern, r.Source, r.Line)
+}
+
 type simpleGlob string
 
 func (g simpleGlob) Match(path string) bool {
@@ -41,13 +78,59 @@ func (g simpleGlob) Match(path string) bool {
 	return strings.HasPrefix(path, string(g)+"/")
 }
 
-func filehash(path string) (string, error) {
+// hashes are the algorithms that can be selected with Hash.
+var hashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+// newHash returns the hash used for file contents. This is the Hash algorithm,
+// md5 by default, unless a HMAC key was provided, in which case it is a
+// HMAC-SHA256 using the key.
+func (ad *DebDiff) newHash() hash.Hash {
+	if ad.hmacKey != nil {
+		return hmac.New(sha256.New, ad.hmacKey)
+	}
+	if h, ok := hashes[ad.Hash]; ok {
+		return h()
+	}
+	return md5.New()
+}
+
+// hashAlgorithm names the hash used by newHash, in the style of the coreutils
+// manifest tags.
+func (ad *DebDiff) hashAlgorithm() string {
+	if ad.hmacKey != nil {
+		return "HMAC-SHA256"
+	}
+	if _, ok := hashes[ad.Hash]; ok {
+		return strings.ToUpper(ad.Hash)
+	}
+	return "MD5"
+}
+
+func (ad *DebDiff) filehash(path string) (string, error) {
+	if ad.hashCache != nil && !ad.VerifyRepro {
+		return ad.cachedFilehash(path)
+	}
+	return ad.hashWith(ad.newHash, path)
+}
+
+// errSpecialFile is returned when hashing a device, FIFO or socket, as opening
+// or reading them may block.
+var errSpecialFile = errors.New("not a regular file")
+
+func hashFile(newHash func() hash.Hash, path string) (string, error) {
+	if info, err := os.Stat(path); err == nil && isSpecial(info.Mode()) {
+		return "", errors.Wrapf(errSpecialFile, "filehash %s", path)
+	}
 	file, err := os.Open(path)
 	if err != nil {
 		return "", errors.Wrap(err, "filehash open error")
 	}
 	defer file.Close()
-	h := md5.New()
+	h := newHash()
 	if _, err := io.Copy(h, file); err != nil {
 		return "", errors.Wrap(err, "filehash copy error")
 	}
@@ -62,61 +145,340 @@ func contains(a []string, x string) bool {
 	return a[i] == x
 }
 
+// dedupSorted removes the repeated entries from the sorted slice a, in place.
+func dedupSorted(a []string) []string {
+	if len(a) == 0 {
+		return a
+	}
+	res := a[:1]
+	for _, x := range a[1:] {
+		if x != res[len(res)-1] {
+			res = append(res, x)
+		}
+	}
+	return res
+}
+
+// dedupUnsorted removes the repeated entries from a, in place, keeping the
+// first of each.
+func dedupUnsorted(a []string) []string {
+	seen := make(stringSet, len(a))
+	res := a[:0]
+	for _, x := range a {
+		if !seen.Contains(x) {
+			seen[x] = struct{}{}
+			res = append(res, x)
+		}
+	}
+	return res
+}
+
+// stringSet provides membership checks for slices that are not sorted.
+type stringSet map[string]struct{}
+
+func newStringSet(lists ...[]string) stringSet {
+	var n int
+	for _, l := range lists {
+		n += len(l)
+	}
+	s := make(stringSet, n)
+	for _, l := range lists {
+		for _, x := range l {
+			s[x] = struct{}{}
+		}
+	}
+	return s
+}
+
+func (s stringSet) Contains(x string) bool {
+	_, ok := s[x]
+	return ok
+}
+
+// The modes select what is reported.
+const (
+	modeDiff          = "diff"
+	modeWorldWritable = "world-writable"
+	modeStrict        = "strict"
+	modeAltOrphans    = "alt-orphans"
+	modeAltDiff       = "alt-diff"
+	modeReclaimable   = "reclaimable"
+	modeFilelessPkg   = "fileless-pkg"
+)
+
+// walksRoot reports if the mode needs to walk the root.
+func walksRoot(mode string) bool {
+	return mode != modeAltOrphans && mode != modeAltDiff
+}
+
+// Logger is where diagnostic messages, such as skipped files, are written. A
+// *log.Logger is a Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
 type DebDiff struct {
-	Silent     bool
-	Root       string
-	Repo       string
-	IgnoreDir  string
-	CpuProfile string
-
-	ignoreGlob     []Glob
-	allFile        []string
-	pkgFile        []string
-	repoFile       []string
-	unpackagedFile []string
-	diffRepoFile   []string
-	alternateFile  []string
-}
-
-func (ad *DebDiff) buildIgnoreGlob() error {
-	err := filepath.Walk(
+	// Sources provide the packaged files, defaulting to dpkg.
+	Sources []PackageSource
+
+	// SkipDirs are directories under the root that are not walked. The
+	// command defaults to pseudo file systems like /proc and /sys.
+	SkipDirs []string
+
+	// Repos are stacked repo overlays, lowest priority first. When empty
+	// Repo is the only overlay.
+	Repos []string
+
+	Silent                    bool
+	Quiet                     bool
+	Root                      string
+	Repo                      string
+	IgnoreDir                 string
+	IgnoreURL                 string
+	IgnoreCache               string
+	CpuProfile                string
+	MemProfile                string
+	Threshold                 string
+	NFC                       bool
+	ModesFrom                 string
+	BackupScript              bool
+	Apply                     bool
+	Yes                       bool
+	BackupDir                 string
+	WalkCache                 string
+	WalkOrder                 string
+	MarksFrom                 string
+	NoSort                    bool
+	Sort                      string
+	Reverse                   bool
+	Explain                   string
+	HMACKey                   string
+	HMACKeyFile               string
+	Mode                      string
+	Strict                    bool
+	SQLite                    string
+	AllowNoDpkg               bool
+	CapsFrom                  string
+	QuietOnClean              bool
+	Paths                     string
+	ResultIn                  string
+	ResultOut                 string
+	ManifestOut               string
+	ManifestIn                string
+	MTime                     bool
+	LocalTime                 bool
+	ExceptFrom                string
+	CreatedSince              time.Duration
+	NoWalk                    bool
+	AltBaseline               string
+	AltSave                   string
+	FailFast                  bool
+	KeepGoing                 bool
+	Verbose                   bool
+	Summary                   bool
+	TotalSize                 bool
+	ActualBlocks              bool
+	VerifyRepro               bool
+	FilelessAllow             string
+	DisplayRoot               string
+	Daemon                    bool
+	DaemonAddr                string
+	DaemonInterval            time.Duration
+	Timeout                   time.Duration
+	ExcludeUnchangedConffiles bool
+	Classify                  bool
+	ShowPackage               bool
+	GroupByPackage            bool
+	Color                     string
+	Format                    string
+	Jobs                      int
+	Hash                      string
+	VerifyPkg                 bool
+	Missing                   bool
+	ExitCode                  bool
+	IgnoreCase                bool
+	MaxSize                   int64
+	HashCache                 string
+	Progress                  bool
+	Filter                    string
+	Print0                    bool
+	Relative                  bool
+	BrokenSymlinks            bool
+	CheckMode                 bool
+	CheckOwner                bool
+	OneFileSystem             bool
+	NoRootIgnore              bool
+	ShowDiff                  bool
+	CollapseDirs              bool
+	DetectRenames             bool
+
+	// Out is where results are written, defaulting to os.Stdout.
+	Out io.Writer
+
+	// OpenFS returns the file system used to walk the root or a repo,
+	// defaulting to os.DirFS. The walk cache and the bfs walk order always
+	// walk the root on disk, as do the later checks of the files found.
+	OpenFS func(dir string) fs.FS
+
+	// Logger receives the diagnostic messages, defaulting to the standard
+	// logger.
+	Logger Logger
+
+	hmacKey         []byte
+	thresholds      []threshold
+	ignoreGlob      []ignoreRule
+	allFile         []string
+	pkgFile         []string
+	repoFile        []string
+	unpackagedFile  []string
+	diffRepoFile    []string
+	alternateFile   []string
+	modeDrift       []modeDrift
+	markDiff        []markDiff
+	worldWritable   []worldWritable
+	unapprovedFile  []string
+	capsDiff        []capsDiff
+	altOrphan       []altOrphan
+	altDiff         []altDiff
+	reclaimable     []dirUsage
+	filelessPkg     []filelessPkg
+	modifiedPkgFile []string
+	missingPkgFile  []string
+	repoOnlyFile    []string
+	brokenSymlink   []brokenSymlink
+	repoModeDiff    []repoModeDiff
+	repoOwnerDiff   []repoOwnerDiff
+	pkgSums         []pkgSumStatus
+	renamedFile     []renamedFile
+	manifestDiff    []ManifestChange
+
+	nondeterministicMu sync.Mutex
+	nondeterministic   []string
+
+	// the errors collected with KeepGoing
+	errsMu sync.Mutex
+	errs   []error
+
+	// the owning package for each packaged file
+	pkgOwner map[string]owner
+
+	// the files of each package, only captured when a feature needs it
+	pkgContents map[string][]string
+
+	// the walked file info, only captured when a feature needs it
+	fileInfo map[string]os.FileInfo
+
+	// the walk caches, only used when enabled
+	walkPrev *walkCache
+	walkNext *walkCache
+
+	// the progress reporter, only used when enabled
+	progress *progress
+
+	// the hash cache, only used when enabled
+	hashCache *hashCacheState
+
+	// the hashes kept in memory between daemon runs without a HashCache
+	keptHashes *hashCache
+
+	// the differing repo files that are missing from the repo
+	rootOnly stringSet
+
+	// the SkipDirs under the root
+	skipDirs stringSet
+
+	// if the text output is colored
+	colored bool
+
+	// the held back stderr output, with QuietOnClean
+	held *heldLog
+
+	// the device of the root, only used with OneFileSystem
+	rootDev *uint64
+
+	// the overlay providing each repo file
+	repoOverlay map[string]string
+
+	// when normalizing, the on disk names for paths that changed
+	rootRaw map[string]string
+	repoRaw map[string]string
+}
+
+// normalize returns the NFC form of path when normalization is enabled. If
+// that differs from path, the original is recorded in raw so the file can
+// still be opened.
+func (ad *DebDiff) normalize(raw map[string]string, path string) string {
+	if !ad.NFC {
+		return path
+	}
+	n := norm.NFC.String(path)
+	if n != path && raw != nil {
+		raw[n] = path
+	}
+	return n
+}
+
+// rawPath returns the on disk name for a possibly normalized path.
+func rawPath(raw map[string]string, path string) string {
+	if r, ok := raw[path]; ok {
+		return r
+	}
+	return path
+}
+
+// rootIgnoreFile is the ignore file automatically loaded from the root.
+const rootIgnoreFile = ".debdiffignore"
+
+// buildIgnoreGlob loads the ignore rules from the IgnoreURL, the IgnoreDir and
+// the rootIgnoreFile, in that order. The rules are additive, so the order only
+// determines which rule is reported as ignoring a path.
+func (ad *DebDiff) buildIgnoreGlob(ctx context.Context) error {
+	if ad.IgnoreURL != "" {
+		if err := ad.buildIgnoreURL(); err != nil {
+			return err
+		}
+	}
+	if err := ad.buildIgnoreDir(ctx); err != nil {
+		return err
+	}
+	return ad.buildRootIgnore()
+}
+
+// buildRootIgnore loads the rootIgnoreFile if one exists in the root.
+func (ad *DebDiff) buildRootIgnore() error {
+	if ad.NoRootIgnore {
+		return nil
+	}
+	path := filepath.Join(ad.Root, rootIgnoreFile)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	return ad.parseIgnoreFile(path)
+}
+
+func (ad *DebDiff) buildIgnoreDir(ctx context.Context) error {
+	if ad.IgnoreDir == "" {
+		return nil
+	}
+	if ad.IgnoreDir == "-" {
+		return ad.parseIgnore(os.Stdin, "stdin")
+	}
+	if info, err := os.Stat(ad.IgnoreDir); err == nil && info.Mode().IsRegular() {
+		return ad.parseIgnoreFile(ad.IgnoreDir)
+	}
+	err := filepath.WalkDir(
 		ad.IgnoreDir,
-		func(path string, info os.FileInfo, err error) error {
+		func(path string, d fs.DirEntry, err error) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			if err != nil {
 				return errors.Wrap(err, "walking ignore directory")
 			}
-			if info.IsDir() {
+			if d.IsDir() {
 				return nil
 			}
-			f, err := os.OpenFile(path, os.O_RDONLY, os.ModePerm)
-			if err != nil {
-				return errors.Wrap(err, "reading ignore file")
-			}
-			defer f.Close()
-
-			sc := bufio.NewScanner(f)
-			for sc.Scan() {
-				l := sc.Text()
-				if len(l) == 0 {
-					continue
-				}
-				if l[0] == '#' {
-					continue
-				}
-				if strings.IndexAny(l, "*?[") > -1 {
-					g, err := glob.Compile(l)
-					if err != nil {
-						return errors.Wrap(err, "invalid glob pattern")
-					}
-					ad.ignoreGlob = append(ad.ignoreGlob, g)
-				} else {
-					ad.ignoreGlob = append(ad.ignoreGlob, simpleGlob(l))
-				}
-			}
-			if err := sc.Err(); err != nil {
-				return errors.Wrap(err, "reading ignore file")
-			}
-			return nil
+			return ad.parseIgnoreFile(path)
 		},
 	)
 	if err != nil {
@@ -125,105 +487,359 @@ func (ad *DebDiff) buildIgnoreGlob() error {
 	return nil
 }
 
+// parseIgnoreFile parses the ignore patterns in the file at path.
+func (ad *DebDiff) parseIgnoreFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDONLY, os.ModePerm)
+	if err != nil {
+		return errors.Wrap(err, "reading ignore file")
+	}
+	defer f.Close()
+	return ad.parseIgnore(f, path)
+}
+
+// stripIgnoreComment removes a # comment and the trailing whitespace from an
+// ignore file line. A literal # can be written as \#.
+func stripIgnoreComment(l string) string {
+	if strings.IndexByte(l, '#') == -1 {
+		return strings.TrimRightFunc(l, unicode.IsSpace)
+	}
+	var b strings.Builder
+	for i := 0; i < len(l); i++ {
+		if l[i] == '\\' && i+1 < len(l) && l[i+1] == '#' {
+			b.WriteByte('#')
+			i++
+			continue
+		}
+		if l[i] == '#' {
+			break
+		}
+		b.WriteByte(l[i])
+	}
+	return strings.TrimRightFunc(b.String(), unicode.IsSpace)
+}
+
+// parseIgnore parses the ignore patterns in r, one per line. The source is
+// recorded along with the patterns. Patterns prefixed with "i:" are matched
+// case-insensitively.
+func (ad *DebDiff) parseIgnore(r io.Reader, source string) error {
+	var line int
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line++
+		l := stripIgnoreComment(sc.Text())
+		if len(l) == 0 {
+			continue
+		}
+		rule := ignoreRule{Pattern: l, Source: source, Line: line}
+		if strings.HasPrefix(l, ignoreFoldPrefix) {
+			rule.Fold = true
+			l = l[len(ignoreFoldPrefix):]
+		}
+		if ad.IgnoreCase {
+			rule.Fold = true
+		}
+		if rule.Fold {
+			l = strings.ToLower(l)
+		}
+		if strings.IndexAny(l, "*?[") > -1 {
+			g, err := glob.Compile(l)
+			if err != nil {
+				return errors.Wrap(err, "invalid glob pattern")
+			}
+			rule.Glob = g
+		} else {
+			rule.Glob = simpleGlob(l)
+		}
+		ad.ignoreGlob = append(ad.ignoreGlob, rule)
+	}
+	if err := sc.Err(); err != nil {
+		return errors.Wrap(err, "reading ignore file")
+	}
+	return nil
+}
+
+// IsIgnored reports if path, relative to the Root, matches an ignore rule.
 func (ad *DebDiff) IsIgnored(path string) bool {
-	for _, glob := range ad.ignoreGlob {
-		if glob.Match(path) {
-			return true
+	return ad.ignoredBy(path) != nil
+}
+
+// ignoredBy returns the first rule that ignores path, or nil.
+func (ad *DebDiff) ignoredBy(path string) *ignoreRule {
+	for i := range ad.ignoreGlob {
+		if ad.ignoreGlob[i].Match(path) {
+			return &ad.ignoreGlob[i]
 		}
 	}
-	return false
+	return nil
 }
 
-func (ad *DebDiff) buildAllFile() error {
-	err := filepath.Walk(
-		ad.Root,
-		func(path string, info os.FileInfo, err error) error {
+func (ad *DebDiff) buildAllFile(ctx context.Context) error {
+	ad.rootRaw = make(map[string]string)
+	if ad.ModesFrom != "" || ad.MTime || ad.BrokenSymlinks ||
+		ad.mode() == modeReclaimable {
+		ad.fileInfo = make(map[string]os.FileInfo)
+	}
+	ad.skipDirs = make(stringSet)
+	for _, dir := range ad.SkipDirs {
+		ad.skipDirs[filepath.Join(ad.Root, dir)] = struct{}{}
+	}
+	if ad.OneFileSystem {
+		info, err := os.Stat(ad.Root)
+		if err != nil {
+			return errors.Wrap(err, "walking all files")
+		}
+		dev, ok := fileDevice(info)
+		if !ok {
+			return errors.New("-one-file-system is not supported on this platform")
+		}
+		ad.rootDev = &dev
+	}
+	if ad.WalkCache != "" || ad.WalkOrder == walkBFS {
+		return ad.buildAllFileCustom(ctx)
+	}
+	err := fs.WalkDir(
+		ad.openFS(ad.Root),
+		".",
+		func(name string, d fs.DirEntry, err error) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			if err != nil {
+				err = fsPathError(ad.Root, err)
 				if os.IsPermission(err) {
-					if !ad.Silent {
-						log.Printf("Skipping file: %s", err)
-					}
+					ad.skip(err)
 					return nil
 				}
-				return errors.Wrap(err, "walking all files")
+				return ad.collect(errors.Wrap(err, "walking all files"))
 			}
-			if ad.IsIgnored(path) {
-				if info.IsDir() {
+			file := filepath.Join("/", filepath.FromSlash(name))
+			path := filepath.Join(ad.Root, file)
+			if ad.IsIgnored(file) {
+				if d.IsDir() {
 					return filepath.SkipDir
 				}
 				return nil
 			}
-			if info.IsDir() {
+			if isSpecial(d.Type()) {
+				ad.skipSpecial(path)
 				return nil
 			}
-			ad.allFile = append(ad.allFile, path)
-			return nil
+			// only stat the files if the info is kept, dirs are always
+			// needed for skipWalkDir
+			var info os.FileInfo
+			if d.IsDir() || ad.fileInfo != nil {
+				if info, err = d.Info(); err != nil {
+					if os.IsNotExist(err) {
+						// removed since the directory was read
+						return nil
+					}
+					return ad.collect(errors.Wrap(err, "walking all files"))
+				}
+			}
+			if d.IsDir() {
+				if ad.skipWalkDir(path, info) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			return ad.collect(ad.addFile(file, info))
 		})
 	if err != nil {
 		return errors.Wrap(err, "walking all files")
 	}
-	sort.Strings(ad.allFile)
+	ad.sortStrings(ad.allFile)
+	return nil
+}
+
+// openFS returns the file system to walk the directory with.
+func (ad *DebDiff) openFS(dir string) fs.FS {
+	if ad.OpenFS != nil {
+		return ad.OpenFS(dir)
+	}
+	return os.DirFS(dir)
+}
+
+// fsPathError places the path in an error from the file system of dir under
+// dir, so it is reported as it would be by the os package.
+func fsPathError(dir string, err error) error {
+	if pe, ok := err.(*fs.PathError); ok && !filepath.IsAbs(pe.Path) {
+		return &fs.PathError{Op: pe.Op, Path: filepath.Join(dir, pe.Path), Err: pe.Err}
+	}
+	return err
+}
+
+// addFile records a walked file, relative to the root like the packaged and
+// repo files it is compared with. The info may be nil if the walk did not stat
+// the file, in which case it will be done here if necessary.
+func (ad *DebDiff) addFile(file string, info os.FileInfo) error {
+	if ad.fileInfo != nil && info == nil {
+		var err error
+		if info, err = os.Lstat(filepath.Join(ad.Root, file)); err != nil {
+			return errors.Wrap(err, "walking all files")
+		}
+	}
+	file = ad.normalize(ad.rootRaw, file)
+	ad.allFile = append(ad.allFile, file)
+	ad.progress.walk()
+	if ad.fileInfo != nil {
+		ad.fileInfo[file] = info
+	}
+	return nil
+}
+
+// repos returns the repo overlays, lowest priority first.
+func (ad *DebDiff) repos() []string {
+	if len(ad.Repos) == 0 {
+		return []string{ad.Repo}
+	}
+	return ad.Repos
+}
+
+// repoPath returns the path of the repo file in the overlay that provides it.
+func (ad *DebDiff) repoPath(file string) string {
+	repo := ad.Repo
+	if r, ok := ad.repoOverlay[file]; ok {
+		repo = r
+	}
+	return filepath.Join(repo, rawPath(ad.repoRaw, file))
+}
+
+// buildRepoFile collects the files in all the repo overlays. A file in a later
+// overlay shadows the same file in an earlier one.
+func (ad *DebDiff) buildRepoFile(ctx context.Context) error {
+	ad.repoRaw = make(map[string]string)
+	ad.repoOverlay = make(map[string]string)
+	for _, repo := range ad.repos() {
+		if err := ad.walkRepo(ctx, repo); err != nil {
+			return err
+		}
+	}
+	ad.sortStrings(ad.repoFile)
 	return nil
 }
 
-func (ad *DebDiff) buildRepoFile() error {
-	err := filepath.Walk(ad.Repo, func(path string, info os.FileInfo, err error) error {
+func (ad *DebDiff) walkRepo(ctx context.Context, repo string) error {
+	raw := make(map[string]string)
+	err := fs.WalkDir(ad.openFS(repo), ".", func(name string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if err != nil {
+			err = fsPathError(repo, err)
 			if !ad.Silent {
-				log.Printf("RepoFile Walk error: %s", err)
+				ad.logf("RepoFile Walk error: %s", err)
 			}
-			return errors.Wrap(err, "walking repo files")
+			return ad.collect(errors.Wrap(err, "walking repo files"))
+		}
+		if d.IsDir() {
+			return nil
 		}
-		if info.IsDir() {
+		if isSpecial(d.Type()) {
+			ad.skipSpecial(filepath.Join(repo, filepath.FromSlash(name)))
 			return nil
 		}
-		name := strings.Replace(path, ad.Repo, "", 1)
-		if name[0] != '/' {
-			name = "/" + name
+		name = ad.normalize(raw, "/"+name)
+		if _, ok := ad.repoOverlay[name]; !ok {
+			ad.repoFile = append(ad.repoFile, name)
+		}
+		ad.repoOverlay[name] = repo
+		if r, ok := raw[name]; ok {
+			ad.repoRaw[name] = r
+		} else {
+			delete(ad.repoRaw, name)
 		}
-		ad.repoFile = append(ad.repoFile, name)
 		return nil
 	})
-	if err != nil {
-		return errors.Wrap(err, "walking repo files")
-	}
-	sort.Strings(ad.repoFile)
-	return nil
+	return errors.Wrap(err, "walking repo files")
 }
 
-func (ad *DebDiff) buildPkgFile() error {
-	lists, err := filepath.Glob(
-		filepath.Join(ad.Root, "var/lib/dpkg/info") + "/*.list")
-	if err != nil {
-		return errors.Wrap(err, "looking for dpkg info lists")
+// dpkgInfoDir returns the dpkg info directory under Root.
+func (ad *DebDiff) dpkgInfoDir() string {
+	return filepath.Join(ad.Root, "var/lib/dpkg/info")
+}
+
+// sources returns the configured package sources, defaulting to dpkg.
+func (ad *DebDiff) sources() []PackageSource {
+	if len(ad.Sources) == 0 {
+		return []PackageSource{DpkgSource{}}
 	}
-	conffiles, err := filepath.Glob(
-		filepath.Join(ad.Root, "var/lib/dpkg/info") + "/*.conffiles")
-	if err != nil {
-		return errors.Wrap(err, "looking for dpkg info lists")
+	return ad.Sources
+}
+
+// buildPkgFile collects the union of the files from all the package sources.
+// The first source to claim a path is recorded as its owner.
+func (ad *DebDiff) buildPkgFile(ctx context.Context) error {
+	ad.pkgOwner = make(map[string]owner)
+	if ad.mode() == modeFilelessPkg {
+		ad.pkgContents = make(map[string][]string)
 	}
-	lists = append(lists, conffiles...)
-	for _, list := range lists {
-		f, err := os.OpenFile(list, os.O_RDONLY, os.ModePerm)
+	for _, source := range ad.sources() {
+		files, err := source.Files(ad.Root)
 		if err != nil {
-			return errors.Wrap(err, "reading dpkg info file")
-		}
-		defer f.Close()
-
-		sc := bufio.NewScanner(f)
-		for sc.Scan() {
-			ad.pkgFile = append(ad.pkgFile, sc.Text())
+			if errors.Cause(err) != errNoDpkgInfo {
+				return err
+			}
+			infoDir := ad.dpkgInfoDir()
+			if !ad.AllowNoDpkg {
+				return errors.Errorf(
+					"dpkg info directory %s does not exist, "+
+						"use -allow-no-dpkg to continue without it", infoDir)
+			}
+			if !ad.Silent {
+				ad.logf("dpkg info directory %s does not exist, "+
+					"no files will be considered packaged by it", infoDir)
+			}
+			continue
 		}
-		if err := sc.Err(); err != nil {
-			return errors.Wrap(err, "reading dpkg info file")
+		for _, file := range files {
+			name := ad.normalize(nil, file.Path)
+			ad.pkgFile = append(ad.pkgFile, name)
+			if _, ok := ad.pkgOwner[name]; !ok {
+				ad.pkgOwner[name] = owner{
+					Source:  source.Name(),
+					Package: file.Package,
+				}
+			}
+			if ad.pkgContents != nil {
+				ad.pkgContents[file.Package] = append(
+					ad.pkgContents[file.Package], name)
+			}
 		}
 	}
-	sort.Strings(ad.pkgFile)
+	ad.sortStrings(ad.pkgFile)
+	// shared directories and conffiles are listed more than once
+	if ad.NoSort {
+		ad.pkgFile = dedupUnsorted(ad.pkgFile)
+	} else {
+		ad.pkgFile = dedupSorted(ad.pkgFile)
+	}
 	return nil
 }
 
-func (ad *DebDiff) buildUnpackagedFile() error {
+// sortStrings sorts a unless sorting has been disabled.
+func (ad *DebDiff) sortStrings(a []string) {
+	if !ad.NoSort {
+		sort.Strings(a)
+	}
+}
+
+func (ad *DebDiff) buildUnpackagedFile(ctx context.Context) error {
+	if ad.NoSort {
+		known := newStringSet(ad.repoFile, ad.pkgFile, ad.alternateFile)
+		for _, name := range ad.allFile {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if !known.Contains(name) {
+				ad.unpackagedFile = append(ad.unpackagedFile, name)
+			}
+		}
+		return nil
+	}
 	for _, name := range ad.allFile {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if contains(ad.repoFile, name) {
 			continue
 		}
@@ -238,66 +854,675 @@ func (ad *DebDiff) buildUnpackagedFile() error {
 	return nil
 }
 
-func (ad *DebDiff) buildAlternateFile() error {
+func (ad *DebDiff) buildAlternateFile(ctx context.Context) error {
 	selections, err := alternatives.GetSelections()
 	if err != nil {
 		return err
 	}
 
-	for _, name := range selections {
-		qr, err := alternatives.Query(name)
-		if err != nil {
-			return err
-		}
-		ad.alternateFile = append(ad.alternateFile, qr.Link)
+	all, err := alternatives.QueryAllN(selections, ad.jobs())
+	if err != nil {
+		return err
+	}
+	for _, qr := range all {
+		ad.alternateFile = append(ad.alternateFile, ad.normalize(nil, qr.Link))
 		for _, slave := range qr.Slaves {
-			ad.alternateFile = append(ad.alternateFile, slave)
+			ad.alternateFile = append(ad.alternateFile, ad.normalize(nil, slave))
 		}
 	}
-	sort.Strings(ad.alternateFile)
+	ad.sortStrings(ad.alternateFile)
 	return nil
 }
 
-func (ad *DebDiff) buildDiffRepoFile() error {
-	for _, file := range ad.repoFile {
-		realpath := filepath.Join(ad.Root, file)
-		repopath := filepath.Join(ad.Repo, file)
-		realhash, err := filehash(realpath)
-		if err != nil && !os.IsNotExist(errors.Cause(err)) {
-			if os.IsPermission(errors.Cause(err)) {
-				if !ad.Silent {
-					log.Printf("Skipping file: %s", err)
+// quickDiffer compares the files without hashing them where possible. When
+// both exist and have different sizes they can't have the same content. Files
+// larger than MaxSize are compared by size and modification time only. The
+// second return value is false if the files need to be hashed.
+func (ad *DebDiff) quickDiffer(a, b string) (bool, bool) {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false, false
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false, false
+	}
+	if ai.Size() != bi.Size() {
+		return true, true
+	}
+	if ad.MaxSize > 0 && ai.Size() > ad.MaxSize {
+		return !ai.ModTime().Equal(bi.ModTime()), true
+	}
+	return false, false
+}
+
+func isSymlink(info os.FileInfo) bool {
+	return info.Mode()&os.ModeSymlink != 0
+}
+
+// isSpecial reports if the mode is a device, FIFO or socket, which are not
+// collected as they cannot be compared by content.
+func isSpecial(mode os.FileMode) bool {
+	return mode&(os.ModeDevice|os.ModeCharDevice|os.ModeNamedPipe|
+		os.ModeSocket|os.ModeIrregular) != 0
+}
+
+// skipSpecial logs a special file being skipped by a walk, with Verbose.
+func (ad *DebDiff) skipSpecial(path string) {
+	if ad.Verbose && !ad.Silent {
+		ad.logf("Skipping special file: %s", path)
+	}
+}
+
+// symlinkStatus compares files where at least one is a symlink by their link
+// targets rather than by the content they point to.
+func symlinkStatus(a, b string, ai, bi os.FileInfo) (DiffStatus, error) {
+	if !isSymlink(ai) || !isSymlink(bi) {
+		return ContentDiffers, nil
+	}
+	at, err := os.Readlink(a)
+	if err != nil {
+		return repoSame, errors.Wrap(err, "reading symlink")
+	}
+	bt, err := os.Readlink(b)
+	if err != nil {
+		return repoSame, errors.Wrap(err, "reading symlink")
+	}
+	if at != bt {
+		return ContentDiffers, nil
+	}
+	return repoSame, nil
+}
+
+// repoSame is the zero DiffStatus, for repo files that match the root.
+const repoSame DiffStatus = 0
+
+// repoFileStatus compares the repo file to the one in the root. Files that
+// cannot be read due to permissions are skipped and reported as the same.
+func (ad *DebDiff) repoFileStatus(file string) (DiffStatus, error) {
+	realpath := ad.rootPath(file)
+	repopath := ad.repoPath(file)
+	realinfo, err := os.Lstat(realpath)
+	if os.IsNotExist(err) {
+		return OnlyInRepo, nil
+	}
+	if err == nil && isSpecial(realinfo.Mode()) {
+		// the repo file was not special, or it would not have been walked
+		return ContentDiffers, nil
+	}
+	if err == nil {
+		if repoinfo, err := os.Lstat(repopath); err == nil {
+			// a repo symlink that would dangle in the root has no content to
+			// compare with
+			if isSymlink(repoinfo) && !isSymlink(realinfo) {
+				target, err := os.Readlink(repopath)
+				if err != nil {
+					return repoSame, errors.Wrap(err, "reading symlink")
+				}
+				if !filepath.IsAbs(target) {
+					target = filepath.Join(filepath.Dir(file), target)
+				}
+				if _, err := statIn(ad.Root, target); os.IsNotExist(err) {
+					return OnlyInRoot, nil
 				}
-				continue
 			}
-			return err
+			if isSymlink(realinfo) || isSymlink(repoinfo) {
+				return symlinkStatus(realpath, repopath, realinfo, repoinfo)
+			}
 		}
-		repohash, err := filehash(repopath)
-		if err != nil && !os.IsNotExist(err) {
-			if os.IsPermission(err) {
-				if !ad.Silent {
-					log.Printf("Skipping file: %s", err)
-				}
-				continue
+	}
+	if differs, ok := ad.quickDiffer(realpath, repopath); ok {
+		if differs {
+			return ContentDiffers, nil
+		}
+		return repoSame, nil
+	}
+	realhash, err := ad.filehash(realpath)
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		if os.IsPermission(errors.Cause(err)) {
+			ad.skip(err)
+			return repoSame, nil
+		}
+		return repoSame, err
+	}
+	repohash, err := ad.filehash(repopath)
+	if os.IsNotExist(errors.Cause(err)) {
+		return OnlyInRoot, nil
+	}
+	if err != nil {
+		if os.IsPermission(errors.Cause(err)) {
+			ad.skip(err)
+			return repoSame, nil
+		}
+		return repoSame, err
+	}
+	if realhash != repohash {
+		return ContentDiffers, nil
+	}
+	return repoSame, nil
+}
+
+// buildDiffRepoFile compares up to Jobs repo files at a time, keeping the
+// differing ones in the repo order. Repo files missing from the root are
+// kept separately.
+func (ad *DebDiff) buildDiffRepoFile(ctx context.Context) error {
+	status := make([]DiffStatus, len(ad.repoFile))
+	attrs := make([]repoAttrs, len(ad.repoFile))
+	errs := make([]error, len(ad.repoFile))
+	err := ad.forEach(ctx, len(ad.repoFile), func(i int) {
+		status[i], errs[i] = ad.repoFileStatus(ad.repoFile[i])
+		attrs[i] = ad.compareRepoAttrs(ad.repoFile[i])
+		if status[i] != repoSame {
+			ad.progress.diff()
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for i, err := range errs {
+		if err != nil {
+			if err := ad.collect(err); err != nil {
+				return err
 			}
-			return err
+			continue
+		}
+		switch status[i] {
+		case ContentDiffers:
+			ad.diffRepoFile = append(ad.diffRepoFile, ad.repoFile[i])
+		case OnlyInRoot:
+			ad.diffRepoFile = append(ad.diffRepoFile, ad.repoFile[i])
+			if ad.rootOnly == nil {
+				ad.rootOnly = make(stringSet)
+			}
+			ad.rootOnly[ad.repoFile[i]] = struct{}{}
+		case OnlyInRepo:
+			ad.repoOnlyFile = append(ad.repoOnlyFile, ad.repoFile[i])
+		}
+		if m := attrs[i].mode; m != nil {
+			ad.repoModeDiff = append(ad.repoModeDiff, *m)
+		}
+		if o := attrs[i].owner; o != nil {
+			ad.repoOwnerDiff = append(ad.repoOwnerDiff, *o)
+		}
+	}
+	return nil
+}
+
+// jobs returns the number of workers to use, defaulting to the number of
+// CPUs.
+func (ad *DebDiff) jobs() int {
+	if ad.Jobs == 0 {
+		return runtime.NumCPU()
+	}
+	return ad.Jobs
+}
+
+// mode returns the effective mode, which is modeStrict with Strict. The zero
+// Mode is modeDiff.
+func (ad *DebDiff) mode() string {
+	if ad.Strict {
+		return modeStrict
+	}
+	if ad.Mode == "" {
+		return modeDiff
+	}
+	return ad.Mode
+}
+
+// modePhases returns the phases that compute the results for the Mode.
+func (ad *DebDiff) modePhases() ([]phase, error) {
+	phases := []phase{
+		{ad.buildIgnoreGlob},
+		{
+			ad.buildAllFile,
+			ad.buildRepoFile,
+			ad.buildPkgFile,
+			ad.buildAlternateFile,
+			ad.buildMarkDiff,
+		},
+		{
+			ad.buildUnpackagedFile,
+			ad.buildDiffRepoFile,
+			ad.buildModeDrift,
+			ad.buildCapsDiff,
+			ad.buildModifiedPkgFile,
+			ad.buildMissingPkgFile,
+			ad.buildBrokenSymlink,
+		},
+	}
+	switch ad.mode() {
+	case modeDiff:
+		phases = append(phases, phase{ad.buildRenamedFile, ad.buildManifestDiff})
+	case modeWorldWritable:
+		phases = []phase{{ad.buildPkgFile}, {ad.buildWorldWritable}}
+	case modeStrict:
+		phases = []phase{
+			{ad.buildIgnoreGlob, ad.buildRepoFile},
+			{ad.buildUnapprovedFile},
+		}
+	case modeAltOrphans:
+		phases = []phase{{ad.buildPkgFile}, {ad.buildAltOrphans}}
+	case modeAltDiff:
+		phases = []phase{{ad.buildAltDiff}}
+	case modeFilelessPkg:
+		phases = []phase{{ad.buildPkgFile}, {ad.buildFilelessPkg}}
+	case modeReclaimable:
+		phases = []phase{
+			{ad.buildIgnoreGlob},
+			{
+				ad.buildAllFile,
+				ad.buildRepoFile,
+				ad.buildPkgFile,
+				ad.buildAlternateFile,
+			},
+			{ad.buildUnpackagedFile},
+			{ad.buildReclaimable},
 		}
-		if realhash != repohash {
-			ad.diffRepoFile = append(ad.diffRepoFile, file)
+	default:
+		return nil, errors.Errorf("unknown mode %q", ad.Mode)
+	}
+	return phases, nil
+}
+
+// loadHMACKey sets up the key from HMACKey or HMACKeyFile.
+func (ad *DebDiff) loadHMACKey() error {
+	if ad.HMACKey != "" {
+		ad.hmacKey = []byte(ad.HMACKey)
+	}
+	if ad.HMACKeyFile != "" {
+		key, err := ioutil.ReadFile(ad.HMACKeyFile)
+		if err != nil {
+			return errors.Wrap(err, "reading hmac key file")
 		}
+		ad.hmacKey = bytes.TrimRight(key, "\r\n")
 	}
 	return nil
 }
 
+// Run computes the results for the configured Mode. With KeepGoing the
+// results are returned along with the errors collected on the way.
+func (ad *DebDiff) Run() (*Result, error) {
+	return ad.RunContext(context.Background())
+}
+
+// RunContext is like Run, but stops early returning the ctx error when ctx is
+// done. Walks and hashing check ctx between files.
+func (ad *DebDiff) RunContext(ctx context.Context) (*Result, error) {
+	ad.reset()
+	phases, err := ad.prepare()
+	if err != nil {
+		return nil, err
+	}
+	if err := ad.processTimeout(ctx, phases); err != nil {
+		return nil, err
+	}
+	return ad.result(), ad.collected()
+}
+
+// prepare validates the configuration and returns the phases for the Mode.
+// With ResultIn the saved result is read instead, and there are no phases.
+func (ad *DebDiff) prepare() ([]phase, error) {
+	if err := ad.Validate(); err != nil {
+		return nil, err
+	}
+	if err := ad.loadHMACKey(); err != nil {
+		return nil, err
+	}
+	if ad.ResultIn != "" {
+		return nil, ad.readResult(ad.ResultIn)
+	}
+	return ad.modePhases()
+}
+
+// processTimeout is process bounded by the Timeout, if one is set.
+func (ad *DebDiff) processTimeout(ctx context.Context, phases []phase) error {
+	if ad.Timeout <= 0 {
+		return ad.process(ctx, phases)
+	}
+	tctx, cancel := context.WithTimeout(ctx, ad.Timeout)
+	defer cancel()
+	err := ad.process(tctx, phases)
+	if err != nil && tctx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return errors.Errorf("timed out after %s", ad.Timeout)
+	}
+	return err
+}
+
+// reset clears the results of a previous run so the phases can be run again.
+func (ad *DebDiff) reset() {
+	ad.ignoreGlob = nil
+	ad.allFile = nil
+	ad.pkgFile = nil
+	ad.repoFile = nil
+	ad.unpackagedFile = nil
+	ad.diffRepoFile = nil
+	ad.alternateFile = nil
+	ad.modeDrift = nil
+	ad.markDiff = nil
+	ad.worldWritable = nil
+	ad.unapprovedFile = nil
+	ad.capsDiff = nil
+	ad.altOrphan = nil
+	ad.altDiff = nil
+	ad.reclaimable = nil
+	ad.filelessPkg = nil
+	ad.modifiedPkgFile = nil
+	ad.pkgSums = nil
+	ad.renamedFile = nil
+	ad.manifestDiff = nil
+	ad.missingPkgFile = nil
+	ad.repoOnlyFile = nil
+	ad.rootOnly = nil
+	ad.brokenSymlink = nil
+	ad.repoModeDiff = nil
+	ad.repoOwnerDiff = nil
+	ad.nondeterministic = nil
+	ad.errs = nil
+	ad.pkgOwner = nil
+	ad.pkgContents = nil
+	ad.fileInfo = nil
+	ad.walkPrev = nil
+	ad.walkNext = nil
+	ad.hashCache = nil
+	ad.progress = nil
+	ad.skipDirs = nil
+	ad.rootDev = nil
+	ad.rootRaw = nil
+	ad.repoRaw = nil
+	ad.repoOverlay = nil
+}
+
+// emit writes a result entry, terminated by a newline or with Print0 by a NUL.
+func (ad *DebDiff) emit(w io.Writer, entry interface{}) {
+	if ad.Print0 {
+		fmt.Fprint(w, entry, "\x00")
+		return
+	}
+	fmt.Fprintln(w, entry)
+}
+
+// logf writes a diagnostic message to the Logger.
+func (ad *DebDiff) logf(format string, v ...interface{}) {
+	if ad.Logger == nil {
+		// keep the caller for log.Lshortfile
+		log.Output(2, fmt.Sprintf(format, v...))
+		return
+	}
+	ad.Logger.Printf(format, v...)
+}
+
+// skip logs a file being skipped due to err. With Quiet the expected
+// permission and not exist errors are not logged.
+func (ad *DebDiff) skip(err error) {
+	if ad.Silent {
+		return
+	}
+	cause := errors.Cause(err)
+	if ad.Quiet && (os.IsPermission(cause) || os.IsNotExist(cause)) {
+		return
+	}
+	ad.logf("Skipping file: %s", err)
+}
+
+// out returns the writer for results.
+func (ad *DebDiff) out() io.Writer {
+	if ad.Out == nil {
+		return os.Stdout
+	}
+	return ad.Out
+}
+
+// process runs the phases and applies the filters to the results.
+func (ad *DebDiff) process(ctx context.Context, phases []phase) error {
+	if ad.HashCache != "" || ad.Daemon {
+		ad.hashCache = &hashCacheState{}
+	}
+	if ad.Progress {
+		ad.progress = startProgress(ad.stderr(), time.Second)
+		defer ad.progress.finish()
+	}
+	if err := ad.runPhases(ctx, phases); err != nil {
+		return err
+	}
+	if err := ad.saveHashCache(); err != nil {
+		return err
+	}
+	ad.sortNondeterministic()
+	if err := ad.applyExcept(); err != nil {
+		return err
+	}
+	if err := ad.applyFilter(); err != nil {
+		return err
+	}
+	if err := ad.excludeUnchangedConffiles(); err != nil {
+		return err
+	}
+	return ad.filterCreatedSince()
+}
+
 func Main() error {
+	if len(os.Args) > 1 && os.Args[1] == "alternatives" {
+		return alternativesMain(os.Args[2:])
+	}
+	if len(os.Args) > 1 && os.Args[1] == "manifest" {
+		return manifestMain(os.Args[2:])
+	}
+
 	var ad DebDiff
 	flag.BoolVar(&ad.Silent, "silent", false, "suppress errors")
-	flag.StringVar(&ad.Root, "root", "/", "installation root")
-	flag.StringVar(&ad.Repo, "repo", "/usr/share/debdiff", "repo directory")
-	flag.StringVar(&ad.IgnoreDir, "ignore", "", "directory of ignore files")
+	flag.BoolVar(&ad.Quiet, "quiet", false,
+		"suppress the expected permission and not exist skip warnings")
+	flag.StringVar(&ad.Root, "root", "/", "installation root, or $DEBDIFF_ROOT")
+	var repos stringList
+	var skipDirs string
+	flag.Var(&repos, "repo",
+		"repo directory, may be repeated with later ones taking precedence "+
+			"(default $DEBDIFF_REPO or /usr/share/debdiff)")
+	flag.StringVar(&ad.IgnoreDir, "ignore", "",
+		"directory of ignore files, a single ignore file, or - for stdin "+
+			"(default $DEBDIFF_IGNORE)")
+	flag.BoolVar(&ad.NoRootIgnore, "no-root-ignore", false,
+		"do not load the "+rootIgnoreFile+" file from the root")
+	flag.BoolVar(&ad.IgnoreCase, "ignore-case", false,
+		"match all ignore patterns case-insensitively")
+	flag.StringVar(&skipDirs, "skip-dirs", strings.Join(defaultSkipDirs, ","),
+		"comma separated directories under the root to not walk, "+
+			"empty to walk everything")
+	flag.BoolVar(&ad.OneFileSystem, "one-file-system", false,
+		"do not walk directories on other file systems than the root")
+	flag.StringVar(&ad.IgnoreURL, "ignore-url", "",
+		"http(s) url of an ignore file")
+	flag.StringVar(&ad.IgnoreCache, "ignore-url-cache", "",
+		"where to cache the ignore url (default in the user cache directory)")
 	flag.StringVar(&ad.CpuProfile, "cpuprofile", "", "write cpu profile here")
+	flag.StringVar(&ad.MemProfile, "memprofile", "",
+		"write memory profile here")
+	flag.BoolVar(&ad.NFC, "nfc", false,
+		"normalize paths to unicode NFC before comparing")
+	flag.StringVar(&ad.ModesFrom, "modes-from", "",
+		"report files whose mode differs from this file of octal-mode path lines")
+	flag.BoolVar(&ad.BackupScript, "backup-script", false,
+		"output a shell script that archives the unpackaged files")
+	flag.BoolVar(&ad.Apply, "apply", false,
+		"copy the differing and missing repo files onto the root, requires -yes")
+	flag.BoolVar(&ad.Yes, "yes", false,
+		"make the changes for -apply instead of printing them")
+	flag.StringVar(&ad.BackupDir, "backup-dir", "",
+		"with -apply, copy the files being replaced into this directory")
+	flag.StringVar(&ad.WalkCache, "walk-cache", "",
+		"cache directory listings here and reuse them for unchanged directories")
+	flag.StringVar(&ad.WalkOrder, "walk-order", walkLexical,
+		"order to walk the root in, lexical or bfs")
+	flag.StringVar(&ad.MarksFrom, "marks-from", "",
+		"compare the apt-mark states of the root against this file of package mark lines")
+	flag.BoolVar(&ad.NoSort, "no-sort", false,
+		"skip sorting, output will be in no particular order")
+	flag.StringVar(&ad.Sort, "sort", sortPath,
+		"order the files by path, size or package")
+	flag.BoolVar(&ad.Reverse, "reverse", false,
+		"reverse the order of the files")
+	flag.StringVar(&ad.Explain, "explain", "",
+		"explain how this path, relative to the root, was classified")
+	flag.StringVar(&ad.HMACKey, "hmac-key", "",
+		"hash file contents with HMAC-SHA256 using this key")
+	flag.StringVar(&ad.HMACKeyFile, "hmac-key-file", "",
+		"hash file contents with HMAC-SHA256 using the key in this file")
+	flag.StringVar(&ad.Mode, "mode", modeDiff,
+		"what to report, one of diff, world-writable, strict, alt-orphans, "+
+			"alt-diff, reclaimable or fileless-pkg")
+	flag.StringVar(&ad.FilelessAllow, "fileless-allow", "",
+		"packages to exclude from -mode=fileless-pkg, one per line")
+	flag.StringVar(&ad.DisplayRoot, "display-root", "",
+		"print paths under the root as if the root was at this path")
+	flag.BoolVar(&ad.ActualBlocks, "actual-blocks", false,
+		"use allocated blocks rather than apparent size with -mode=reclaimable")
+	flag.BoolVar(&ad.NoWalk, "no-walk", false,
+		"ensure the file system is not walked, only valid for alternatives modes")
+	flag.StringVar(&ad.AltBaseline, "alt-baseline", "",
+		"alternatives snapshot to compare against with -mode=alt-diff")
+	flag.StringVar(&ad.AltSave, "alt-save", "",
+		"save the alternatives snapshot here with -mode=alt-diff")
+	flag.BoolVar(&ad.Strict, "strict", false,
+		"only report modified packaged files that are not in the repo")
+	flag.StringVar(&ad.SQLite, "sqlite", "",
+		"also write the results to this sqlite database")
+	flag.BoolVar(&ad.AllowNoDpkg, "allow-no-dpkg", false,
+		"continue if the dpkg info directory does not exist")
+	flag.StringVar(&ad.CapsFrom, "caps-from", "",
+		"compare file capabilities against this getcap style baseline")
+	flag.BoolVar(&ad.QuietOnClean, "quiet-on-clean", false,
+		"produce no output other than errors when nothing differs")
+	flag.StringVar(&ad.Paths, "paths", "",
+		"use both to print the root and repo paths of differing repo files")
+	flag.StringVar(&ad.ResultIn, "result-in", "",
+		"report the result saved by -result-out instead of scanning")
+	flag.StringVar(&ad.ManifestOut, "manifest-out", "",
+		"write the -hash of every walked regular file here, in the sha256sum --tag format")
+	flag.StringVar(&ad.ManifestIn, "manifest-in", "",
+		"report the walked files added, removed or changed since this -manifest-out")
+	flag.StringVar(&ad.ResultOut, "result-out", "",
+		"save the result here in a binary format")
+	flag.BoolVar(&ad.MTime, "mtime", false,
+		"include the modification time of each file")
+	flag.BoolVar(&ad.LocalTime, "localtime", false,
+		"show times in the local timezone instead of UTC")
+	flag.StringVar(&ad.ExceptFrom, "except-from", "",
+		"exclude the paths listed in this file from the results")
+	flag.DurationVar(&ad.CreatedSince, "created-since", 0,
+		"only report unpackaged files created within this duration")
+	flag.BoolVar(&ad.Verbose, "v", false,
+		"log the duration of each build step and the items it produced, and the "+
+			"devices, FIFOs and sockets skipped by the walks")
+	flag.BoolVar(&ad.KeepGoing, "keep-going", false,
+		"report every walk and hash error at the end instead of stopping at the first")
+	flag.BoolVar(&ad.FailFast, "fail-fast", false,
+		"cancel the other concurrent steps on the first error")
+	flag.BoolVar(&ad.VerifyRepro, "verify-repro", false,
+		"hash every file twice and report files whose hashes differ")
+	flag.BoolVar(&ad.ExitCode, "exit-code", false,
+		"exit with status 1 if there are unpackaged or modified repo files, or "+
+			"-manifest-in changes")
+	flag.BoolVar(&ad.Missing, "missing", false,
+		"report packaged files that do not exist")
+	flag.BoolVar(&ad.VerifyPkg, "verify-pkg", false,
+		"report packaged files that differ from the dpkg md5sums")
+	flag.StringVar(&ad.Hash, "hash", "md5",
+		"hash algorithm for file contents, one of md5, sha1 or sha256")
+	flag.BoolVar(&ad.CollapseDirs, "collapse-dirs", false,
+		"print a directory with only unpackaged files once instead of each file")
+	flag.BoolVar(&ad.DetectRenames, "detect-renames", false,
+		"report repo files missing from the root as renamed to an unpackaged file "+
+			"with the same content")
+	flag.BoolVar(&ad.ShowDiff, "show-diff", false,
+		"print a unified diff for each modified repo text file")
+	flag.BoolVar(&ad.CheckOwner, "check-owner", false,
+		"report repo files whose uid or gid differ from the root")
+	flag.BoolVar(&ad.CheckMode, "check-mode", false,
+		"report repo files whose permissions differ from the root")
+	flag.BoolVar(&ad.BrokenSymlinks, "report-broken-symlinks", false,
+		"report symlinks whose target does not exist")
+	flag.BoolVar(&ad.Relative, "relative", false,
+		"print paths under the root relative to it")
+	flag.BoolVar(&ad.Print0, "print0", false,
+		"terminate result entries with NUL instead of newline")
+	flag.StringVar(&ad.Filter, "filter", "",
+		"only report paths matching this glob, e.g. /etc/**")
+	flag.BoolVar(&ad.Progress, "progress", false,
+		"report progress to stderr while walking and hashing")
+	flag.StringVar(&ad.HashCache, "hash-cache", "",
+		"cache file hashes here and reuse them for files with the same size "+
+			"and mtime")
+	flag.Int64Var(&ad.MaxSize, "max-size", 0,
+		"compare repo files larger than this many bytes by size and mtime "+
+			"instead of hashing")
+	flag.IntVar(&ad.Jobs, "jobs", runtime.NumCPU(),
+		"number of concurrent workers for hashing and queries")
+	flag.DurationVar(&ad.Timeout, "timeout", 0,
+		"abort if a run takes longer than this, 0 for no limit")
+	flag.BoolVar(&ad.Summary, "summary", false,
+		"print the totals to stderr, or include them in the json output")
+	flag.BoolVar(&ad.TotalSize, "total-size", false,
+		"print the total size of the unpackaged files after the results")
+	flag.StringVar(&ad.Color, "color", colorAuto,
+		"color the text output, auto, always or never")
+	flag.StringVar(&ad.Format, "format", formatText,
+		"output format, text, json or debsums for the -verify-pkg results, json also works with -mode=alt-diff")
+	flag.BoolVar(&ad.Classify, "classify", false,
+		"prefix unpackaged files with U and modified repo files with M")
+	flag.BoolVar(&ad.ShowPackage, "show-package", false,
+		"prefix modified files with the package that owns them")
+	flag.BoolVar(&ad.GroupByPackage, "group-by-package", false,
+		"print the files grouped under the package that owns them")
+	flag.BoolVar(&ad.ExcludeUnchangedConffiles, "exclude-unchanged-conffiles", false,
+		"hide differing repo files that are conffiles dpkg shipped unchanged")
+	flag.BoolVar(&ad.Daemon, "daemon", false,
+		"run repeatedly and serve the latest result over http")
+	flag.StringVar(&ad.DaemonAddr, "daemon-addr", "localhost:9185",
+		"address to serve /status and /metrics on with -daemon")
+	flag.DurationVar(&ad.DaemonInterval, "daemon-interval", 5*time.Minute,
+		"how often to run with -daemon")
+	flag.StringVar(&ad.Threshold, "threshold", "",
+		"comma separated thresholds, e.g. unpackaged<=100,diffRepo<=0")
+	var sources string
+	flag.StringVar(&sources, "sources", "dpkg",
+		"comma separated package databases to read, dpkg or opkg")
+	var pkgLists stringList
+	flag.Var(&pkgLists, "pkg-list",
+		"file listing additional packaged paths, may be repeated")
 	flag.Parse()
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	if err := applyEnvFlags(flag.CommandLine); err != nil {
+		return err
+	}
+
+	thresholds, err := parseThresholds(ad.Threshold)
+	if err != nil {
+		return err
+	}
+	ad.thresholds = thresholds
+
+	if skipDirs != "" {
+		ad.SkipDirs = strings.Split(skipDirs, ",")
+	}
+
+	ad.Repo = "/usr/share/debdiff"
+	if len(repos) > 0 {
+		ad.Repo = repos[0]
+		ad.Repos = repos
+	}
+
+	ad.Sources, err = parseSources(sources)
+	if err != nil {
+		return err
+	}
+	if len(pkgLists) > 0 {
+		ad.Sources = append(ad.Sources, ListSource{Lists: pkgLists})
+	}
+
+	phases, err := ad.prepare()
+	if err != nil {
+		return err
+	}
 
 	if ad.CpuProfile != "" {
 		f, err := os.Create(ad.CpuProfile)
@@ -309,36 +1534,234 @@ func Main() error {
 		defer pprof.StopCPUProfile()
 	}
 
-	steps := []func() error{
-		ad.buildIgnoreGlob,
-		ad.buildAllFile,
-		ad.buildRepoFile,
-		ad.buildPkgFile,
-		ad.buildAlternateFile,
-		ad.buildUnpackagedFile,
-		ad.buildDiffRepoFile,
+	if ad.MemProfile != "" {
+		f, err := os.Create(ad.MemProfile)
+		if err != nil {
+			return errors.Wrap(err, "error creating memory profile")
+		}
+		defer f.Close()
+		defer func() {
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				ad.logf("Writing memory profile: %s", err)
+			}
+		}()
+	}
+
+	// held log output is flushed unless the run turns out to be clean
+	if ad.QuietOnClean {
+		ad.held = &heldLog{}
+		ad.held.start()
+		defer ad.held.flush()
+	}
+
+	if ad.Daemon {
+		return ad.runDaemon(phases)
+	}
+
+	if err := ad.processTimeout(context.Background(), phases); err != nil {
+		return err
 	}
-	for _, step := range steps {
-		if err := step(); err != nil {
+
+	if ad.ResultOut != "" {
+		if err := ad.writeResult(ad.ResultOut); err != nil {
 			return err
 		}
 	}
 
-	diff := make([]string, 0, len(ad.unpackagedFile)+len(ad.diffRepoFile))
-	diff = append(diff, ad.unpackagedFile...)
-	diff = append(diff, ad.diffRepoFile...)
-	sort.Strings(diff)
+	if ad.ManifestOut != "" {
+		if err := ad.writeManifest(context.Background(), ad.ManifestOut); err != nil {
+			return err
+		}
+	}
 
-	for _, file := range diff {
-		fmt.Println(file)
+	if ad.SQLite != "" {
+		if err := ad.writeSQLite(ad.SQLite); err != nil {
+			return err
+		}
 	}
 
-	return nil
-}
+	out := ad.out()
+	ad.colored = ad.Format == formatText && ad.useColor(out)
+	if ad.QuietOnClean && ad.Explain == "" && ad.findings() == 0 {
+		ad.held.discard()
+		return ad.done()
+	}
 
-func main() {
-	if err := Main(); err != nil {
-		fmt.Fprintf(os.Stderr, "%+v", err)
-		os.Exit(1)
+	if ad.mode() == modeWorldWritable {
+		for _, w := range ad.worldWritable {
+			w.Path = ad.display(w.Path)
+			ad.emit(out, w)
+		}
+		return ad.done()
 	}
+	if ad.mode() == modeStrict {
+		for _, file := range ad.unapprovedFile {
+			ad.emit(out, ad.displayRel(file))
+		}
+		return ad.done()
+	}
+	if ad.mode() == modeAltOrphans {
+		for _, a := range ad.altOrphan {
+			ad.emit(out, a)
+		}
+		return ad.done()
+	}
+	if ad.mode() == modeFilelessPkg {
+		for _, f := range ad.filelessPkg {
+			ad.emit(out, f)
+		}
+		return ad.done()
+	}
+	if ad.mode() == modeReclaimable {
+		if err := ad.writeReclaimable(out); err != nil {
+			return errors.Wrap(err, "writing reclaimable space")
+		}
+		return ad.done()
+	}
+	if ad.mode() == modeAltDiff {
+		if ad.Format == formatJSON {
+			if err := ad.writeAltDiffJSON(out); err != nil {
+				return err
+			}
+			return ad.done()
+		}
+		for _, d := range ad.altDiff {
+			ad.emit(out, d)
+		}
+		return ad.done()
+	}
+
+	if ad.Explain != "" {
+		return ad.explain(out, ad.Explain)
+	}
+
+	if ad.Apply {
+		if err := ad.applyRepoFiles(out); err != nil {
+			return err
+		}
+		return ad.done()
+	}
+
+	if ad.BackupScript {
+		if err := ad.writeBackupScript(out); err != nil {
+			return errors.Wrap(err, "writing backup script")
+		}
+		return ad.done()
+	}
+
+	if ad.Format == formatJSON {
+		if err := ad.writeJSON(out); err != nil {
+			return err
+		}
+		return ad.done()
+	}
+
+	if ad.Format == formatDebsums {
+		ad.writeDebsums(out)
+		return ad.done()
+	}
+
+	var groups packageGroups
+	if ad.GroupByPackage {
+		groups = make(packageGroups)
+	}
+	diff := make([]diffLine, 0, len(ad.unpackagedFile)+len(ad.diffRepoFile))
+	for _, file := range ad.unpackagedLines() {
+		line := ad.classify("U", ad.annotate(file, ad.displayUnpackaged(file)))
+		d := diffLine{File: file, Line: line, Color: colorUnpackaged}
+		if groups != nil {
+			groups.add(unpackagedGroup, d)
+			continue
+		}
+		diff = append(diff, d)
+	}
+	for _, file := range ad.diffRepoFile {
+		line := ad.displayRel(file)
+		if ad.Paths == pathsBoth {
+			line = ad.bothPaths(file)
+		}
+		line = ad.classify("M", ad.withPackage(file, ad.annotate(file, line)))
+		d := diffLine{File: file, Line: line, Color: colorModified}
+		if groups != nil {
+			groups.add(ad.packageOf(file), d)
+			continue
+		}
+		diff = append(diff, d)
+	}
+	if groups != nil {
+		for _, file := range ad.modifiedPkgFile {
+			groups.add(ad.packageOf(file), diffLine{
+				File:  file,
+				Line:  fmt.Sprintf("%s: modified package file", ad.displayRel(file)),
+				Color: colorModified,
+			})
+		}
+		ad.writeGroups(out, groups)
+	}
+	ad.sortLines(diff)
+
+	for _, d := range diff {
+		ad.emit(out, ad.colorize(d.Color, d.Line))
+	}
+	for _, m := range ad.modeDrift {
+		m.Path = ad.display(m.Path)
+		ad.emit(out, m)
+	}
+	for _, m := range ad.markDiff {
+		ad.emit(out, m)
+	}
+	for _, c := range ad.capsDiff {
+		c.Path = ad.display(c.Path)
+		ad.emit(out, c)
+	}
+	for _, file := range ad.nondeterministic {
+		ad.emit(out, fmt.Sprintf("%s: nondeterministic hash", ad.displayDisk(file)))
+	}
+	if groups == nil {
+		for _, file := range ad.modifiedPkgFile {
+			line := fmt.Sprintf("%s: modified package file", ad.displayRel(file))
+			ad.emit(out, ad.colorize(colorModified, ad.withPackage(file, line)))
+		}
+	}
+	for _, m := range ad.repoModeDiff {
+		m.Path = ad.displayRel(m.Path)
+		ad.emit(out, m)
+	}
+	for _, o := range ad.repoOwnerDiff {
+		o.Path = ad.displayRel(o.Path)
+		ad.emit(out, o)
+	}
+	for _, b := range ad.brokenSymlink {
+		b.Path = ad.display(b.Path)
+		ad.emit(out, b)
+	}
+	for _, file := range ad.repoOnlyFile {
+		line := fmt.Sprintf("%s: only in repo", ad.displayRel(file))
+		ad.emit(out, ad.colorize(colorMissing, line))
+	}
+	for _, r := range ad.renamedFile {
+		r.From = ad.displayRel(r.From)
+		r.To = ad.display(r.To)
+		ad.emit(out, ad.colorize(colorModified, r.String()))
+	}
+	for _, c := range ad.manifestDiff {
+		c.Path = ad.displayRel(c.Path)
+		ad.emit(out, c)
+	}
+	for _, file := range ad.missingPkgFile {
+		line := fmt.Sprintf("%s: missing package file", ad.displayRel(file))
+		ad.emit(out, ad.colorize(colorMissing, line))
+	}
+	if ad.ShowDiff {
+		ad.writeDiffs(out)
+	}
+	if ad.TotalSize {
+		ad.emit(out, ad.totalSizeLine())
+	}
+	if ad.Summary {
+		ad.summary().write(ad.stderr())
+	}
+
+	return ad.done()
 }
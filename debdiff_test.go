@@ -0,0 +1,263 @@
+package debdiff
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates the files under dir, keyed by their slash separated path
+// relative to dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testDebDiff returns a DebDiff for a root and repo created in a temporary
+// directory. The root has a dpkg info directory listing the packaged files.
+func testDebDiff(t *testing.T, root, repo map[string]string, packaged ...string) *DebDiff {
+	t.Helper()
+	// the alternatives are always read from the host
+	if _, err := exec.LookPath("update-alternatives"); err != nil {
+		t.Skip("update-alternatives is not available")
+	}
+	dir := t.TempDir()
+	ad := &DebDiff{
+		Root:   filepath.Join(dir, "root"),
+		Repo:   filepath.Join(dir, "repo"),
+		Silent: true,
+	}
+	list := "/.\n"
+	for _, file := range packaged {
+		list += file + "\n"
+	}
+	writeFiles(t, ad.Root, map[string]string{
+		"var/lib/dpkg/info/test.list": list,
+		// the dpkg database itself is not what is being tested
+		rootIgnoreFile: "/var/lib/dpkg/*\n/" + rootIgnoreFile + "\n",
+	})
+	writeFiles(t, ad.Root, root)
+	if err := os.MkdirAll(ad.Repo, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, ad.Repo, repo)
+	return ad
+}
+
+// unpackaged runs ad and returns the unpackaged files.
+func unpackaged(t *testing.T, ad *DebDiff) []string {
+	t.Helper()
+	res, err := ad.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.UnpackagedFile
+}
+
+func TestRunZeroMode(t *testing.T) {
+	ad := testDebDiff(t,
+		map[string]string{"etc/a": "a", "etc/b": "b", "etc/c": "c"},
+		map[string]string{"etc/b": "b"},
+		"/etc", "/etc/a")
+	got := unpackaged(t, ad)
+	want := []string{"/etc/c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestRunStrictTwice(t *testing.T) {
+	ad := testDebDiff(t, nil, nil)
+	ad.Strict = true
+	for i := 0; i < 2; i++ {
+		if _, err := ad.Run(); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+	if ad.Mode != "" {
+		t.Fatalf("Mode was changed to %q", ad.Mode)
+	}
+}
+
+func TestRunNFC(t *testing.T) {
+	const nfc, nfd = "etc/caf\u00e9", "etc/cafe\u0301"
+	cases := []struct {
+		nfc        bool
+		unpackaged []string
+	}{
+		{nfc: false, unpackaged: []string{"/" + nfc}},
+		{nfc: true},
+	}
+	for _, c := range cases {
+		ad := testDebDiff(t,
+			map[string]string{nfc: "x", "etc/differs": "old"},
+			map[string]string{nfd: "x", "etc/differs": "new"},
+			"/etc")
+		ad.NFC = c.nfc
+		res, err := ad.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(res.UnpackagedFile, c.unpackaged) {
+			t.Fatalf("nfc %v: got unpackaged %q, want %q", c.nfc, res.UnpackagedFile, c.unpackaged)
+		}
+		if want := []string{"/etc/differs"}; !reflect.DeepEqual(res.DiffRepoFile, want) {
+			t.Fatalf("nfc %v: got differing %q, want %q", c.nfc, res.DiffRepoFile, want)
+		}
+		missing := ad.has(ad.repoOnlyFile, "/"+nfd)
+		if missing == c.nfc {
+			t.Fatalf("nfc %v: the NFD repo file missing from the root is %v", c.nfc, missing)
+		}
+	}
+}
+
+func TestParseIgnoreFold(t *testing.T) {
+	ad := &DebDiff{}
+	patterns := "i:/etc/Foo/*\n/etc/Bar/*\ni:/VAR/LOG\n"
+	if err := ad.parseIgnore(strings.NewReader(patterns), "test"); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		path    string
+		ignored bool
+	}{
+		{"/etc/Foo/a", true},
+		{"/etc/foo/a", true},
+		{"/ETC/FOO/A", true},
+		{"/etc/Bar/a", true},
+		{"/etc/bar/a", false},
+		{"/ETC/BAR/a", false},
+		{"/var/log", true},
+		{"/var/Log", true},
+		{"/var/Log/a", true},
+		{"/var/logs", false},
+	}
+	for _, c := range cases {
+		if got := ad.IsIgnored(c.path); got != c.ignored {
+			t.Errorf("%s: got ignored %v, want %v", c.path, got, c.ignored)
+		}
+	}
+}
+
+func TestParseIgnoreCRLF(t *testing.T) {
+	ad := &DebDiff{}
+	patterns := "# comment\r\n/etc/a\r\n\r\n/var/*.log # logs\r\n/tmp"
+	if err := ad.parseIgnore(strings.NewReader(patterns), "test"); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, rule := range ad.ignoreGlob {
+		got = append(got, rule.Pattern)
+	}
+	if want := []string{"/etc/a", "/var/*.log", "/tmp"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got patterns %q, want %q", got, want)
+	}
+	for _, path := range []string{"/etc/a", "/var/x.log", "/tmp"} {
+		if !ad.IsIgnored(path) {
+			t.Errorf("%s is not ignored", path)
+		}
+	}
+}
+
+func TestRunDanglingRepoSymlink(t *testing.T) {
+	ad := testDebDiff(t,
+		map[string]string{
+			"etc/file":     "f",
+			"etc/link":     "l",
+			"etc/abs-host": "h",
+			"etc/abs-root": "r",
+			"etc/target":   "t",
+		},
+		map[string]string{"etc/target": "t"},
+		"/etc")
+	links := map[string]string{
+		"etc/file":     "nowhere",
+		"etc/link":     "nowhere",
+		"etc/abs-host": "/bin/sh",
+		"etc/abs-root": "/etc/target",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(ad.Repo, filepath.FromSlash(name))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Remove(filepath.Join(ad.Root, "etc", "file")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("nowhere", filepath.Join(ad.Root, "etc", "file")); err != nil {
+		t.Fatal(err)
+	}
+	res, err := ad.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same dangling symlink in both is not a difference, and the targets
+	// are resolved within the root
+	want := []RepoDiff{
+		{Path: "/etc/abs-host", Status: OnlyInRoot},
+		{Path: "/etc/abs-root", Status: ContentDiffers},
+		{Path: "/etc/link", Status: OnlyInRoot},
+	}
+	if !reflect.DeepEqual(res.RepoDiff, want) {
+		t.Fatalf("got %v, want %v", res.RepoDiff, want)
+	}
+}
+
+func TestRunNoSortDedup(t *testing.T) {
+	ad := testDebDiff(t, map[string]string{"etc/a": "a", "etc/b": "b"}, nil,
+		"/etc", "/etc/a", "/etc/gone", "/etc/a", "/etc/gone")
+	ad.NoSort = true
+	if _, err := ad.Run(); err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for _, file := range ad.pkgFile {
+		if seen[file] {
+			t.Fatalf("%s is packaged twice in %v", file, ad.pkgFile)
+		}
+		seen[file] = true
+	}
+	if want := []string{"/etc/b"}; !reflect.DeepEqual(ad.unpackagedFile, want) {
+		t.Fatalf("got unpackaged %v, want %v", ad.unpackagedFile, want)
+	}
+}
+
+func BenchmarkUnpackagedFile(b *testing.B) {
+	var all, pkg []string
+	for i := 0; i < 100000; i++ {
+		file := fmt.Sprintf("/usr/share/doc/pkg%d/file%d", i/10, i)
+		all = append(all, file)
+		if i%3 != 0 {
+			pkg = append(pkg, file)
+		}
+	}
+	sort.Strings(all)
+	sort.Strings(pkg)
+	for _, c := range []struct {
+		name   string
+		noSort bool
+	}{{"sorted", false}, {"map", true}} {
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ad := &DebDiff{NoSort: c.noSort, allFile: all, pkgFile: pkg}
+				if err := ad.buildUnpackagedFile(context.Background()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
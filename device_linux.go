@@ -0,0 +1,14 @@
+package debdiff
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileDevice returns the device the file resides on.
+func fileDevice(info os.FileInfo) (uint64, bool) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Dev), true
+	}
+	return 0, false
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package debdiff
+
+import "os"
+
+// fileDevice is only supported on linux.
+func fileDevice(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,45 @@
+package debdiff
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// envFlags are the environment variables providing values for flags. A flag
+// given on the command line takes precedence over its variable, which takes
+// precedence over the flag default. DEBDIFF_REPO may hold a list of repos
+// separated like PATH, lowest priority first.
+var envFlags = []struct {
+	Flag string
+	Env  string
+}{
+	{"root", "DEBDIFF_ROOT"},
+	{"repo", "DEBDIFF_REPO"},
+	{"ignore", "DEBDIFF_IGNORE"},
+}
+
+// applyEnvFlags sets the flags that were not given from their environment
+// variables.
+func applyEnvFlags(fs *flag.FlagSet) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for _, ef := range envFlags {
+		v := os.Getenv(ef.Env)
+		if given[ef.Flag] || v == "" {
+			continue
+		}
+		values := []string{v}
+		if ef.Flag == "repo" {
+			values = filepath.SplitList(v)
+		}
+		for _, value := range values {
+			if err := fs.Set(ef.Flag, value); err != nil {
+				return errors.Wrapf(err, "invalid %s", ef.Env)
+			}
+		}
+	}
+	return nil
+}
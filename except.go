@@ -0,0 +1,159 @@
+package debdiff
+
+import (
+	"bufio"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gobwas/glob"
+	"github.com/pkg/errors"
+)
+
+// readPathList reads a file containing one path per line.
+func readPathList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading path list")
+	}
+	defer f.Close()
+
+	var res []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		l := strings.TrimSpace(sc.Text())
+		if len(l) == 0 || l[0] == '#' {
+			continue
+		}
+		res = append(res, l)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading path list")
+	}
+	return res, nil
+}
+
+// dropStrings returns the entries of a for which drop returns false. The
+// order of a is preserved.
+func dropStrings(a []string, drop func(string) bool) []string {
+	res := a[:0]
+	for _, x := range a {
+		if !drop(x) {
+			res = append(res, x)
+		}
+	}
+	return res
+}
+
+// dropPaths removes the paths for which drop returns true from all the
+// results.
+func (ad *DebDiff) dropPaths(drop func(string) bool) {
+	ad.unpackagedFile = dropStrings(ad.unpackagedFile, drop)
+	ad.diffRepoFile = dropStrings(ad.diffRepoFile, drop)
+	ad.unapprovedFile = dropStrings(ad.unapprovedFile, drop)
+	ad.nondeterministic = dropStrings(ad.nondeterministic, drop)
+	ad.modifiedPkgFile = dropStrings(ad.modifiedPkgFile, drop)
+	ad.missingPkgFile = dropStrings(ad.missingPkgFile, drop)
+	ad.repoOnlyFile = dropStrings(ad.repoOnlyFile, drop)
+
+	modeDrift := ad.modeDrift[:0]
+	for _, m := range ad.modeDrift {
+		if !drop(m.Path) {
+			modeDrift = append(modeDrift, m)
+		}
+	}
+	ad.modeDrift = modeDrift
+
+	worldWritable := ad.worldWritable[:0]
+	for _, w := range ad.worldWritable {
+		if !drop(w.Path) {
+			worldWritable = append(worldWritable, w)
+		}
+	}
+	ad.worldWritable = worldWritable
+
+	capsDiff := ad.capsDiff[:0]
+	for _, c := range ad.capsDiff {
+		if !drop(c.Path) {
+			capsDiff = append(capsDiff, c)
+		}
+	}
+	ad.capsDiff = capsDiff
+
+	brokenSymlink := ad.brokenSymlink[:0]
+	for _, b := range ad.brokenSymlink {
+		if !drop(b.Path) {
+			brokenSymlink = append(brokenSymlink, b)
+		}
+	}
+	ad.brokenSymlink = brokenSymlink
+
+	repoModeDiff := ad.repoModeDiff[:0]
+	for _, m := range ad.repoModeDiff {
+		if !drop(m.Path) {
+			repoModeDiff = append(repoModeDiff, m)
+		}
+	}
+	ad.repoModeDiff = repoModeDiff
+
+	repoOwnerDiff := ad.repoOwnerDiff[:0]
+	for _, o := range ad.repoOwnerDiff {
+		if !drop(o.Path) {
+			repoOwnerDiff = append(repoOwnerDiff, o)
+		}
+	}
+	ad.repoOwnerDiff = repoOwnerDiff
+
+	pkgSums := ad.pkgSums[:0]
+	for _, s := range ad.pkgSums {
+		if !drop(s.Path) {
+			pkgSums = append(pkgSums, s)
+		}
+	}
+	ad.pkgSums = pkgSums
+
+	renamedFile := ad.renamedFile[:0]
+	for _, r := range ad.renamedFile {
+		if !drop(r.To) {
+			renamedFile = append(renamedFile, r)
+		}
+	}
+	ad.renamedFile = renamedFile
+
+	manifestDiff := ad.manifestDiff[:0]
+	for _, c := range ad.manifestDiff {
+		if !drop(c.Path) {
+			manifestDiff = append(manifestDiff, c)
+		}
+	}
+	ad.manifestDiff = manifestDiff
+}
+
+// applyExcept removes the paths listed in the ExceptFrom file from all the
+// results. Unlike ignore patterns these are exact paths, applied after the
+// files have been classified.
+func (ad *DebDiff) applyExcept() error {
+	if ad.ExceptFrom == "" {
+		return nil
+	}
+	except, err := readPathList(ad.ExceptFrom)
+	if err != nil {
+		return err
+	}
+	sort.Strings(except)
+	ad.dropPaths(func(path string) bool { return contains(except, path) })
+	return nil
+}
+
+// applyFilter keeps only the result paths matching the Filter glob.
+func (ad *DebDiff) applyFilter() error {
+	if ad.Filter == "" {
+		return nil
+	}
+	g, err := glob.Compile(ad.Filter)
+	if err != nil {
+		return errors.Wrap(err, "invalid filter pattern")
+	}
+	ad.dropPaths(func(path string) bool { return !g.Match(path) })
+	return nil
+}
@@ -0,0 +1,44 @@
+package debdiff
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestApplyExcept(t *testing.T) {
+	except := filepath.Join(t.TempDir(), "except")
+	list := "# known\n/etc/a\n\n  /etc/c  \n/etc/missing\n"
+	if err := os.WriteFile(except, []byte(list), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ad := &DebDiff{
+		ExceptFrom:     except,
+		unpackagedFile: []string{"/etc/a", "/etc/b", "/etc/c"},
+		diffRepoFile:   []string{"/etc/c", "/etc/d"},
+		repoOnlyFile:   []string{"/etc/a"},
+		modeDrift:      []modeDrift{{Path: "/etc/a"}, {Path: "/etc/e"}},
+		renamedFile:    []renamedFile{{From: "/etc/old", To: "/etc/c"}},
+		manifestDiff:   []ManifestChange{{Kind: ManifestAdded, Path: "/etc/f"}},
+	}
+	if err := ad.applyExcept(); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"unpackaged", ad.unpackagedFile, []string{"/etc/b"}},
+		{"diffRepo", ad.diffRepoFile, []string{"/etc/d"}},
+		{"repoOnly", ad.repoOnlyFile, []string{}},
+		{"modeDrift", ad.modeDrift, []modeDrift{{Path: "/etc/e"}}},
+		{"renamed", ad.renamedFile, []renamedFile{}},
+		{"manifestDiff", ad.manifestDiff, []ManifestChange{{Kind: ManifestAdded, Path: "/etc/f"}}},
+	}
+	for _, c := range cases {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package debdiff
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// has checks membership in one of the collected slices, which are only sorted
+// if sorting hasn't been disabled.
+func (ad *DebDiff) has(a []string, x string) bool {
+	if !ad.NoSort {
+		return contains(a, x)
+	}
+	for _, v := range a {
+		if v == x {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoredWithin returns the rule ignoring path or one of its parents, as the
+// walk skips ignored directories, along with the ignored path.
+func (ad *DebDiff) ignoredWithin(path string) (*ignoreRule, string) {
+	for p := path; ; p = filepath.Dir(p) {
+		if rule := ad.ignoredBy(p); rule != nil {
+			return rule, p
+		}
+		if p == filepath.Dir(p) {
+			return nil, ""
+		}
+	}
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// explain writes the decisions that lead to the classification of path, which
+// is relative to the root.
+func (ad *DebDiff) explain(w io.Writer, path string) error {
+	path = filepath.Join("/", path)
+
+	rule, ignored := ad.ignoredWithin(path)
+
+	walked := ad.has(ad.allFile, path)
+	repo := ad.has(ad.repoFile, path)
+	pkg := ad.has(ad.pkgFile, path)
+	alternate := ad.has(ad.alternateFile, path)
+
+	var class string
+	switch {
+	case rule != nil:
+		class = "ignored"
+	case !walked && !repo:
+		class = "not found"
+	case repo && ad.has(ad.repoOnlyFile, path):
+		class = "repo, missing from root"
+	case repo && ad.has(ad.diffRepoFile, path):
+		class = "repo, differs"
+	case repo:
+		class = "repo, same"
+	case pkg:
+		class = "packaged"
+	case alternate:
+		class = "alternative"
+	default:
+		class = "unpackaged"
+	}
+
+	fmt.Fprintf(w, "path: %s\n", path)
+	fmt.Fprintf(w, "walked: %s\n", yesNo(walked))
+	if rule != nil {
+		fmt.Fprintf(w, "ignored: yes, %s by %s\n", ignored, rule)
+	} else {
+		fmt.Fprintf(w, "ignored: no\n")
+	}
+	fmt.Fprintf(w, "repo: %s\n", yesNo(repo))
+	fmt.Fprintf(w, "packaged: %s\n", yesNo(pkg))
+	fmt.Fprintf(w, "alternative: %s\n", yesNo(alternate))
+	_, err := fmt.Fprintf(w, "classification: %s\n", class)
+	return err
+}
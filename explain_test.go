@@ -0,0 +1,38 @@
+package debdiff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExplainClass(t *testing.T) {
+	ad := testDebDiff(t,
+		map[string]string{"etc/same": "s", "etc/differs": "old", "etc/pkg": "p", "etc/other": "o"},
+		map[string]string{"etc/same": "s", "etc/differs": "new", "etc/missing": "m"},
+		"/etc", "/etc/pkg")
+	if _, err := ad.Run(); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		path  string
+		class string
+	}{
+		{"/etc/same", "repo, same"},
+		{"/etc/differs", "repo, differs"},
+		{"/etc/missing", "repo, missing from root"},
+		{"/etc/pkg", "packaged"},
+		{"/etc/other", "unpackaged"},
+		{"/etc/none", "not found"},
+		{"/var/lib/dpkg/info/test.list", "ignored"},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		if err := ad.explain(&buf, c.path); err != nil {
+			t.Fatal(err)
+		}
+		if want := "classification: " + c.class + "\n"; !strings.Contains(buf.String(), want) {
+			t.Fatalf("%s: want %q in:\n%s", c.path, want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package debdiff
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// filelessPkg is an installed package none of whose files are present.
+type filelessPkg struct {
+	Package string
+	Listed  int
+}
+
+func (f filelessPkg) String() string {
+	return fmt.Sprintf("%s (%d files listed, none present)", f.Package, f.Listed)
+}
+
+// buildFilelessPkg finds packages that list files, none of which exist.
+// Packages that list only directories, or nothing at all, are assumed to be
+// metapackages and are not reported. Packages in the FilelessAllow file are
+// also excluded.
+func (ad *DebDiff) buildFilelessPkg(ctx context.Context) error {
+	var allow []string
+	if ad.FilelessAllow != "" {
+		var err error
+		if allow, err = readPathList(ad.FilelessAllow); err != nil {
+			return err
+		}
+		sort.Strings(allow)
+	}
+
+	for pkg, files := range ad.pkgContents {
+		if contains(allow, pkg) {
+			continue
+		}
+		var listed, present int
+		for _, file := range files {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			info, err := os.Lstat(filepath.Join(ad.Root, file))
+			if err != nil {
+				if os.IsPermission(err) {
+					ad.skip(err)
+					continue
+				}
+				if !os.IsNotExist(err) {
+					return errors.Wrap(err, "checking package files")
+				}
+				listed++
+				continue
+			}
+			if info.IsDir() {
+				continue
+			}
+			listed++
+			present++
+			break
+		}
+		if listed > 0 && present == 0 {
+			ad.filelessPkg = append(ad.filelessPkg, filelessPkg{pkg, listed})
+		}
+	}
+	sort.Slice(ad.filelessPkg, func(i, j int) bool {
+		return ad.filelessPkg[i].Package < ad.filelessPkg[j].Package
+	})
+	return nil
+}
@@ -0,0 +1,79 @@
+package debdiff
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	formatText    = "text"
+	formatJSON    = "json"
+	formatDebsums = "debsums"
+)
+
+// jsonCounts are the sizes of the lists in jsonOutput.
+type jsonCounts struct {
+	Unpackaged int `json:"unpackaged"`
+	DiffRepo   int `json:"diff_repo"`
+	RepoOnly   int `json:"repo_only"`
+	Repo       int `json:"repo"`
+}
+
+// jsonOutput is written with -format=json. Unpackaged are files not owned by
+// any package or the repo, DiffRepo are repo files that differ on disk,
+// RepoOnly are repo files missing from disk, Renamed are those found under
+// another path with -detect-renames and Repo are all the files in the repo.
+// Lists other than Renamed are always present, and empty
+// rather than null when there is nothing in them.
+type jsonOutput struct {
+	Unpackaged []string      `json:"unpackaged"`
+	DiffRepo   []string      `json:"diff_repo"`
+	RepoOnly   []string      `json:"repo_only"`
+	Renamed    []renamedFile `json:"renamed,omitempty"`
+	Repo       []string      `json:"repo"`
+	Counts     jsonCounts    `json:"counts"`
+	Summary    *summary      `json:"summary,omitempty"`
+}
+
+// nonNil returns an empty slice for a nil one so it serializes as [].
+func nonNil(a []string) []string {
+	if a == nil {
+		return []string{}
+	}
+	return a
+}
+
+// writeJSON writes the diff results as a single JSON object.
+func (ad *DebDiff) writeJSON(w io.Writer) error {
+	lines := ad.unpackagedLines()
+	unpackaged := make([]string, 0, len(lines))
+	for _, file := range lines {
+		unpackaged = append(unpackaged, ad.displayUnpackaged(file))
+	}
+	var renamed []renamedFile
+	for _, r := range ad.renamedFile {
+		renamed = append(renamed, renamedFile{From: r.From, To: ad.display(r.To)})
+	}
+	out := jsonOutput{
+		Unpackaged: unpackaged,
+		DiffRepo:   nonNil(ad.diffRepoFile),
+		RepoOnly:   nonNil(ad.repoOnlyFile),
+		Renamed:    renamed,
+		Repo:       nonNil(ad.repoFile),
+		Counts: jsonCounts{
+			Unpackaged: len(ad.unpackagedFile),
+			DiffRepo:   len(ad.diffRepoFile),
+			RepoOnly:   len(ad.repoOnlyFile),
+			Repo:       len(ad.repoFile),
+		},
+	}
+	if ad.Summary {
+		s := ad.summary()
+		out.Summary = &s
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(out), "writing json")
+}
@@ -1,6 +1,23 @@
-module "github.com/daaku/debdiff"
+module github.com/daaku/debdiff
+
+go 1.27.1
+
+require (
+	github.com/gobwas/glob v0.2.3
+	github.com/pkg/errors v0.8.0
+	golang.org/x/sync v0.23.0
+	golang.org/x/sys v0.48.0
+	golang.org/x/text v0.42.0
+	modernc.org/sqlite v1.60.0
+)
 
 require (
-	"github.com/gobwas/glob" v0.2.3
-	"github.com/pkg/errors" v0.8.0
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/mattn/go-isatty v0.0.24 // indirect
+	github.com/ncruces/go-strftime v1.0.0 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	modernc.org/libc v1.77.1 // indirect
+	modernc.org/mathutil v1.7.1 // indirect
+	modernc.org/memory v1.12.1 // indirect
 )
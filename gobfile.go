@@ -0,0 +1,48 @@
+package debdiff
+
+import (
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// loadGob decodes the named cache file into v, returning false if it
+// doesn't exist or cannot be decoded.
+func (ad *DebDiff) loadGob(path, name string, v interface{}) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) && !ad.Silent {
+			ad.logf("Ignoring %s: %s", name, err)
+		}
+		return false
+	}
+	defer f.Close()
+	if err := gob.NewDecoder(f).Decode(v); err != nil {
+		if !ad.Silent {
+			ad.logf("Ignoring corrupt %s: %s", name, err)
+		}
+		return false
+	}
+	return true
+}
+
+// saveGob atomically replaces the named cache file with v.
+func saveGob(path, name string, v interface{}) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", name)
+	}
+	if err := gob.NewEncoder(f).Encode(v); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return errors.Wrapf(err, "writing %s", name)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return errors.Wrapf(err, "writing %s", name)
+	}
+	return errors.Wrapf(os.Rename(f.Name(), path), "writing %s", name)
+}
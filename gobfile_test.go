@@ -0,0 +1,42 @@
+package debdiff
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGobRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	ad := &DebDiff{Silent: true}
+	var got map[string]int
+	if ad.loadGob(path, "test cache", &got) {
+		t.Fatal("loaded a missing file")
+	}
+
+	want := map[string]int{"a": 1, "b": 2}
+	if err := saveGob(path, "test cache", want); err != nil {
+		t.Fatal(err)
+	}
+	if !ad.loadGob(path, "test cache", &got) {
+		t.Fatal("could not load the saved file")
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	if err := os.WriteFile(path, []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ad.loadGob(path, "test cache", &got) {
+		t.Fatal("loaded a corrupt file")
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d files, want only the cache", len(entries))
+	}
+}
@@ -0,0 +1,47 @@
+package debdiff
+
+import (
+	"io"
+	"sort"
+)
+
+// unpackagedGroup is the GroupByPackage heading for files without a package.
+const unpackagedGroup = "(unpackaged)"
+
+// packageGroups are the output lines grouped by the package owning the file.
+type packageGroups map[string][]diffLine
+
+func (g packageGroups) add(pkg string, line diffLine) {
+	g[pkg] = append(g[pkg], line)
+}
+
+// packageOf returns the package owning the file, or unpackagedGroup.
+func (ad *DebDiff) packageOf(file string) string {
+	if o, ok := ad.pkgOwner[file]; ok && o.Package != "" {
+		return o.Package
+	}
+	return unpackagedGroup
+}
+
+// writeGroups writes each package heading followed by its indented lines. The
+// packages are sorted by name, with unpackagedGroup last.
+func (ad *DebDiff) writeGroups(w io.Writer, g packageGroups) {
+	pkgs := make([]string, 0, len(g))
+	for pkg := range g {
+		if pkg != unpackagedGroup {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	sort.Strings(pkgs)
+	if _, ok := g[unpackagedGroup]; ok {
+		pkgs = append(pkgs, unpackagedGroup)
+	}
+	for _, pkg := range pkgs {
+		ad.emit(w, pkg+":")
+		lines := g[pkg]
+		ad.sortLines(lines)
+		for _, d := range lines {
+			ad.emit(w, "  "+ad.colorize(d.Color, d.Line))
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package debdiff
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// hashCacheVersion is bumped whenever the hash cache format changes, which
+// invalidates existing caches.
+const hashCacheVersion = 1
+
+// hashCache maps paths to their content hash as of a given size and mtime.
+// The cache is only valid for the Hash it was built with.
+type hashCache struct {
+	Version int
+	Hash    string
+	Files   map[string]hashCacheEntry
+}
+
+type hashCacheEntry struct {
+	Size    int64
+	ModTime time.Time
+	Sum     string
+}
+
+// hashCacheState holds the loaded and the next caches for a run.
+type hashCacheState struct {
+	once sync.Once
+	mu   sync.Mutex
+	prev *hashCache
+	next *hashCache
+}
+
+// hashName identifies the hash in use by its hashAlgorithm, including a
+// fingerprint of the HMAC key so cached sums are not reused with a different
+// key.
+func (ad *DebDiff) hashName() string {
+	if ad.hmacKey != nil {
+		return fmt.Sprintf("%s:%x", ad.hashAlgorithm(), sha256.Sum256(ad.hmacKey))
+	}
+	return ad.hashAlgorithm()
+}
+
+// loadHashCache loads the cache, returning an empty one if it doesn't exist
+// or cannot be used. Without a HashCache the hashes kept from the previous
+// daemon run are used.
+func (ad *DebDiff) loadHashCache() *hashCache {
+	empty := &hashCache{
+		Version: hashCacheVersion,
+		Hash:    ad.hashName(),
+		Files:   make(map[string]hashCacheEntry),
+	}
+	if ad.HashCache == "" {
+		if ad.keptHashes != nil && ad.keptHashes.Hash == empty.Hash {
+			return ad.keptHashes
+		}
+		return empty
+	}
+	var hc hashCache
+	if !ad.loadGob(ad.HashCache, "hash cache", &hc) {
+		return empty
+	}
+	if hc.Version != hashCacheVersion || hc.Hash != empty.Hash || hc.Files == nil {
+		return empty
+	}
+	return &hc
+}
+
+// cachedFilehash returns the hash of the file, reusing the cached hash if
+// the size and mtime are unchanged.
+func (ad *DebDiff) cachedFilehash(path string) (string, error) {
+	hs := ad.hashCache
+	hs.once.Do(func() {
+		hs.prev = ad.loadHashCache()
+		hs.next = &hashCache{
+			Version: hashCacheVersion,
+			Hash:    hs.prev.Hash,
+			Files:   make(map[string]hashCacheEntry),
+		}
+	})
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", errors.Wrap(err, "filehash open error")
+	}
+	hs.mu.Lock()
+	cached, ok := hs.prev.Files[path]
+	hs.mu.Unlock()
+	if ok && cached.Size == info.Size() && cached.ModTime.Equal(info.ModTime()) {
+		hs.mu.Lock()
+		hs.next.Files[path] = cached
+		hs.mu.Unlock()
+		return cached.Sum, nil
+	}
+
+	sum, err := ad.hashWith(ad.newHash, path)
+	if err != nil {
+		return "", err
+	}
+	hs.mu.Lock()
+	hs.next.Files[path] = hashCacheEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Sum:     sum,
+	}
+	hs.mu.Unlock()
+	return sum, nil
+}
+
+// saveHashCache writes the hashes used in this run, if any files were hashed,
+// or keeps them in memory without a HashCache.
+func (ad *DebDiff) saveHashCache() error {
+	if ad.hashCache == nil || ad.hashCache.next == nil {
+		return nil
+	}
+	if ad.HashCache == "" {
+		ad.keptHashes = ad.hashCache.next
+		return nil
+	}
+	return ad.hashCache.next.save(ad.HashCache)
+}
+
+// save atomically replaces the cache file.
+func (hc *hashCache) save(path string) error {
+	return saveGob(path, "hash cache", hc)
+}
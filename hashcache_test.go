@@ -0,0 +1,22 @@
+package debdiff
+
+import "testing"
+
+func TestHashName(t *testing.T) {
+	cases := []struct {
+		hash string
+		key  []byte
+		want string
+	}{
+		{"", nil, "MD5"},
+		{"md5", nil, "MD5"},
+		{"sha256", nil, "SHA256"},
+		{"sha256", []byte("key"), "HMAC-SHA256:2c70e12b7a0646f92279f427c7b38e7334d8e5389cff167a1dc30e73f826b683"},
+	}
+	for _, c := range cases {
+		ad := &DebDiff{Hash: c.hash, hmacKey: c.key}
+		if got := ad.hashName(); got != c.want {
+			t.Errorf("%q %q: got %q, want %q", c.hash, c.key, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package debdiff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ignoreURLTimeout bounds fetching the ignore url.
+const ignoreURLTimeout = 30 * time.Second
+
+// ignoreCachePath returns where the ignore url is cached.
+func (ad *DebDiff) ignoreCachePath() (string, error) {
+	if ad.IgnoreCache != "" {
+		return ad.IgnoreCache, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.Wrap(err, "finding ignore url cache")
+	}
+	name := fmt.Sprintf("ignore-%x", sha256.Sum256([]byte(ad.IgnoreURL)))
+	return filepath.Join(dir, "debdiff", name[:len("ignore-")+16]), nil
+}
+
+func fetchIgnoreURL(url string) ([]byte, error) {
+	client := http.Client{Timeout: ignoreURLTimeout}
+	res, err := client.Get(url)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching ignore url")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("fetching ignore url %q: %s", url, res.Status)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching ignore url")
+	}
+	return body, nil
+}
+
+// buildIgnoreURL fetches and parses the ignore url. A successful fetch is
+// cached, and the cached copy is used if a later fetch fails.
+func (ad *DebDiff) buildIgnoreURL() error {
+	cache, err := ad.ignoreCachePath()
+	if err != nil {
+		return err
+	}
+	body, err := fetchIgnoreURL(ad.IgnoreURL)
+	if err != nil {
+		cached, cacheErr := ioutil.ReadFile(cache)
+		if cacheErr != nil {
+			return err
+		}
+		if !ad.Silent {
+			ad.logf("Using cached ignore url: %s", err)
+		}
+		return ad.parseIgnore(bytes.NewReader(cached), cache)
+	}
+	if err := os.MkdirAll(filepath.Dir(cache), 0755); err != nil {
+		return errors.Wrap(err, "caching ignore url")
+	}
+	if err := ioutil.WriteFile(cache, body, 0644); err != nil {
+		return errors.Wrap(err, "caching ignore url")
+	}
+	return ad.parseIgnore(bytes.NewReader(body), ad.IgnoreURL)
+}
@@ -0,0 +1,53 @@
+package debdiff
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// multiError is the errors collected with KeepGoing.
+type multiError []error
+
+func (m multiError) Error() string {
+	lines := make([]string, len(m))
+	for i, err := range m {
+		lines[i] = "\t" + err.Error()
+	}
+	return fmt.Sprintf("%d errors occurred:\n%s", len(m), strings.Join(lines, "\n"))
+}
+
+// collect records err with KeepGoing and returns nil so the caller carries on
+// with the next file. Otherwise, or if the run was canceled, err is returned.
+func (ad *DebDiff) collect(err error) error {
+	if !ad.KeepGoing || err == nil {
+		return err
+	}
+	if cause := errors.Cause(err); cause == context.Canceled ||
+		cause == context.DeadlineExceeded {
+		return err
+	}
+	ad.errsMu.Lock()
+	defer ad.errsMu.Unlock()
+	ad.errs = append(ad.errs, err)
+	return nil
+}
+
+// collected returns the errors collected with KeepGoing, or nil if there were
+// none. The steps run concurrently, so they are sorted to be deterministic.
+func (ad *DebDiff) collected() error {
+	if len(ad.errs) == 0 {
+		return nil
+	}
+	errs := append(multiError(nil), ad.errs...)
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Error() < errs[j].Error()
+	})
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errs
+}
@@ -0,0 +1,203 @@
+package debdiff
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ManifestEntry is a line of a manifest, in the format used by the coreutils
+// *sum tools.
+type ManifestEntry struct {
+	// Algorithm is the tag of a BSD style line, like SHA256, and is empty for
+	// an untagged line.
+	Algorithm string
+	Hash      string
+	Path      string
+}
+
+// The kinds of ManifestChange.
+const (
+	ManifestAdded   = 'A'
+	ManifestRemoved = 'D'
+	ManifestChanged = 'M'
+)
+
+// ManifestChange is a difference between two manifests.
+type ManifestChange struct {
+	Kind byte
+	Path string
+	// OldHash is empty for added entries.
+	OldHash string
+	// NewHash is empty for removed entries.
+	NewHash string
+}
+
+func (c ManifestChange) String() string {
+	return string(c.Kind) + " " + c.Path
+}
+
+// parseManifestLine parses "hash  path", "hash *path" for binary mode, or the
+// BSD style "ALGORITHM (path) = hash". Like coreutils, a leading backslash
+// marks a path with escaped backslashes and newlines.
+func parseManifestLine(l string) (ManifestEntry, error) {
+	escaped := strings.HasPrefix(l, "\\")
+	if escaped {
+		l = l[1:]
+	}
+	i := strings.IndexByte(l, ' ')
+	if i == -1 || i+2 > len(l) {
+		return ManifestEntry{}, errors.Errorf("invalid manifest line: %q", l)
+	}
+	var e ManifestEntry
+	switch l[i+1] {
+	case ' ', '*':
+		e = ManifestEntry{Hash: l[:i], Path: l[i+2:]}
+	case '(':
+		j := strings.LastIndex(l, ") = ")
+		if j < i+2 {
+			return ManifestEntry{}, errors.Errorf("invalid manifest line: %q", l)
+		}
+		e = ManifestEntry{Algorithm: l[:i], Hash: l[j+4:], Path: l[i+2 : j]}
+	default:
+		return ManifestEntry{}, errors.Errorf("invalid manifest line: %q", l)
+	}
+	if escaped {
+		e.Path = unescapeManifestPath(e.Path)
+	}
+	return e, nil
+}
+
+// String formats the entry as a manifest line, BSD style if it has an
+// Algorithm, escaping the path like coreutils if it contains a backslash or a
+// newline.
+func (e ManifestEntry) String() string {
+	prefix, path := "", e.Path
+	if strings.ContainsAny(path, "\\\n") {
+		prefix = "\\"
+		path = strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(path)
+	}
+	if e.Algorithm != "" {
+		return prefix + e.Algorithm + " (" + path + ") = " + e.Hash
+	}
+	return prefix + e.Hash + "  " + path
+}
+
+func unescapeManifestPath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		if p[i] == '\\' && i+1 < len(p) {
+			i++
+			if p[i] == 'n' {
+				b.WriteByte('\n')
+				continue
+			}
+		}
+		b.WriteByte(p[i])
+	}
+	return b.String()
+}
+
+// manifestReader reads the entries of a manifest sorted by path.
+type manifestReader struct {
+	sc   *bufio.Scanner
+	prev string
+	line int
+}
+
+func newManifestReader(r io.Reader) *manifestReader {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1024*1024)
+	return &manifestReader{sc: sc}
+}
+
+// next returns the next entry, or false at the end of the manifest.
+func (m *manifestReader) next() (ManifestEntry, bool, error) {
+	for m.sc.Scan() {
+		m.line++
+		if m.sc.Text() == "" {
+			continue
+		}
+		e, err := parseManifestLine(m.sc.Text())
+		if err != nil {
+			return ManifestEntry{}, false, err
+		}
+		if m.line > 1 && e.Path <= m.prev {
+			return ManifestEntry{}, false, errors.Errorf(
+				"manifest not sorted by path at line %d: %q", m.line, e.Path)
+		}
+		m.prev = e.Path
+		return e, true, nil
+	}
+	return ManifestEntry{}, false, errors.Wrap(m.sc.Err(), "reading manifest")
+}
+
+// manifestSource yields manifest entries sorted by path.
+type manifestSource interface {
+	next() (ManifestEntry, bool, error)
+}
+
+// entryList is a manifestSource for entries already in memory.
+type entryList []ManifestEntry
+
+func (l *entryList) next() (ManifestEntry, bool, error) {
+	if len(*l) == 0 {
+		return ManifestEntry{}, false, nil
+	}
+	e := (*l)[0]
+	*l = (*l)[1:]
+	return e, true, nil
+}
+
+// CompareManifests merges two manifests sorted by path, calling fn with each
+// entry added, removed or changed in b relative to a. Only the current entry
+// of each manifest is held in memory.
+func CompareManifests(a, b io.Reader, fn func(ManifestChange) error) error {
+	return compareManifests(newManifestReader(a), newManifestReader(b), fn)
+}
+
+func compareManifests(ra, rb manifestSource, fn func(ManifestChange) error) error {
+	ea, oka, err := ra.next()
+	if err != nil {
+		return err
+	}
+	eb, okb, err := rb.next()
+	if err != nil {
+		return err
+	}
+	for oka || okb {
+		var c *ManifestChange
+		switch {
+		case !okb || oka && ea.Path < eb.Path:
+			c = &ManifestChange{Kind: ManifestRemoved, Path: ea.Path, OldHash: ea.Hash}
+			ea, oka, err = ra.next()
+		case !oka || eb.Path < ea.Path:
+			c = &ManifestChange{Kind: ManifestAdded, Path: eb.Path, NewHash: eb.Hash}
+			eb, okb, err = rb.next()
+		default:
+			if ea.Hash != eb.Hash {
+				c = &ManifestChange{
+					Kind:    ManifestChanged,
+					Path:    ea.Path,
+					OldHash: ea.Hash,
+					NewHash: eb.Hash,
+				}
+			}
+			if ea, oka, err = ra.next(); err != nil {
+				return err
+			}
+			eb, okb, err = rb.next()
+		}
+		if err != nil {
+			return err
+		}
+		if c != nil {
+			if err := fn(*c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
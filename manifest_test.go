@@ -0,0 +1,194 @@
+package debdiff
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestManifestLine(t *testing.T) {
+	cases := []struct {
+		line  string
+		entry ManifestEntry
+	}{
+		{"abc  /etc/a", ManifestEntry{Hash: "abc", Path: "/etc/a"}},
+		{"\\abc  /etc/a\\\\b\\nc", ManifestEntry{Hash: "abc", Path: "/etc/a\\b\nc"}},
+		{"SHA256 (/etc/a) = abc", ManifestEntry{Algorithm: "SHA256", Hash: "abc", Path: "/etc/a"}},
+		{"SHA256 (/etc/(a) = b) = abc", ManifestEntry{Algorithm: "SHA256", Hash: "abc", Path: "/etc/(a) = b"}},
+		{
+			"\\HMAC-SHA256 (/etc/a\\\\b) = abc",
+			ManifestEntry{Algorithm: "HMAC-SHA256", Hash: "abc", Path: "/etc/a\\b"},
+		},
+	}
+	for _, c := range cases {
+		e, err := parseManifestLine(c.line)
+		if err != nil {
+			t.Fatalf("%q: %v", c.line, err)
+		}
+		if e != c.entry {
+			t.Fatalf("%q: got %+v, want %+v", c.line, e, c.entry)
+		}
+		if e.String() != c.line {
+			t.Fatalf("%+v: got %q, want %q", e, e.String(), c.line)
+		}
+	}
+
+	// binary mode is read but not written
+	e, err := parseManifestLine("abc */etc/a")
+	if err != nil || e != (ManifestEntry{Hash: "abc", Path: "/etc/a"}) {
+		t.Fatalf("binary mode: got %+v, %v", e, err)
+	}
+	for _, line := range []string{"abc", "abc /etc/a", "SHA256 (/etc/a)"} {
+		if _, err := parseManifestLine(line); err == nil {
+			t.Fatalf("%q: expected an error", line)
+		}
+	}
+}
+
+func TestManifestInAlgorithm(t *testing.T) {
+	cases := []struct {
+		name     string
+		manifest string
+		hmacKey  string
+		err      string
+	}{
+		{name: "same", manifest: "MD5 (/etc/a) = 0cc175b9c0f1b6a831c399e269772661\n"},
+		{name: "untagged", manifest: "0cc175b9c0f1b6a831c399e269772661  /etc/a\n"},
+		{
+			name:     "other hash",
+			manifest: "SHA1 (/etc/a) = 86f7e437faa5a7fce15d1ddcb9eaeaea377667b8\n",
+			err:      "was written with SHA1, not -hash=md5",
+		},
+		{
+			name:     "untagged other hash",
+			manifest: "86f7e437faa5a7fce15d1ddcb9eaeaea377667b8  /etc/a\n",
+			err:      "was not written with -hash=md5",
+		},
+		{
+			name:     "hmac",
+			manifest: "MD5 (/etc/a) = 0cc175b9c0f1b6a831c399e269772661\n",
+			hmacKey:  "key",
+			err:      "was written with MD5, not the -hmac-key HMAC-SHA256",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ad := testDebDiff(t, map[string]string{"etc/a": "a"}, nil, "/etc", "/etc/a")
+			ad.ManifestIn = filepath.Join(t.TempDir(), "manifest")
+			ad.HMACKey = c.hmacKey
+			if err := os.WriteFile(ad.ManifestIn, []byte(c.manifest), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ad.Run()
+			if c.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(ad.manifestDiff) != 0 {
+					t.Fatalf("unexpected changes %v", ad.manifestDiff)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Fatalf("got error %v, want %q", err, c.err)
+			}
+		})
+	}
+}
+
+func TestCompareManifestsNaive(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	var a, b strings.Builder
+	ma := make(map[string]string)
+	mb := make(map[string]string)
+	for i := 0; i < 20000; i++ {
+		path := fmt.Sprintf("/d%03d/f%05d", i/100, i)
+		hash := fmt.Sprintf("%032x", rnd.Int63())
+		inA, inB := rnd.Intn(10) != 0, rnd.Intn(10) != 0
+		if inA {
+			ma[path] = hash
+			fmt.Fprintf(&a, "%s  %s\n", hash, path)
+		}
+		if inB {
+			if rnd.Intn(10) == 0 {
+				hash = fmt.Sprintf("%032x", rnd.Int63())
+			}
+			mb[path] = hash
+			fmt.Fprintf(&b, "%s  %s\n", hash, path)
+		}
+	}
+
+	var want []ManifestChange
+	for path, ha := range ma {
+		hb, ok := mb[path]
+		switch {
+		case !ok:
+			want = append(want, ManifestChange{Kind: ManifestRemoved, Path: path, OldHash: ha})
+		case ha != hb:
+			want = append(want, ManifestChange{Kind: ManifestChanged, Path: path, OldHash: ha, NewHash: hb})
+		}
+	}
+	for path, hb := range mb {
+		if _, ok := ma[path]; !ok {
+			want = append(want, ManifestChange{Kind: ManifestAdded, Path: path, NewHash: hb})
+		}
+	}
+	sort.Slice(want, func(i, j int) bool { return want[i].Path < want[j].Path })
+
+	var got []ManifestChange
+	err := CompareManifests(strings.NewReader(a.String()), strings.NewReader(b.String()),
+		func(c ManifestChange) error {
+			got = append(got, c)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) == 0 {
+		t.Fatal("the manifests are the same")
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %d changes, want %d", len(got), len(want))
+	}
+}
+
+func TestManifestEntriesJobs(t *testing.T) {
+	root := make(map[string]string)
+	for i := 0; i < 200; i++ {
+		root[fmt.Sprintf("etc/d%d/f%d", i%7, i)] = strings.Repeat("x", i)
+	}
+	ad := testDebDiff(t, root, nil, "/etc")
+	if _, err := ad.Run(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	ad.Jobs = 1
+	serial, err := ad.manifestEntries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(serial) < 200 {
+		t.Fatalf("got %d entries, want at least 200", len(serial))
+	}
+	for _, repro := range []bool{false, true} {
+		ad.Jobs = 8
+		ad.VerifyRepro = repro
+		ad.nondeterministic = nil
+		entries, err := ad.manifestEntries(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(entries, serial) {
+			t.Fatalf("repro %v: the concurrent manifest differs from the serial one", repro)
+		}
+		if len(ad.nondeterministic) != 0 {
+			t.Fatalf("repro %v: got nondeterministic files %v", repro, ad.nondeterministic)
+		}
+	}
+}
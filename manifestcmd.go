@@ -0,0 +1,36 @@
+package debdiff
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// manifestMain implements the "debdiff manifest" subcommands.
+func manifestMain(args []string) error {
+	if len(args) != 3 || args[0] != "compare" {
+		return errors.New("usage: debdiff manifest compare <old> <new>")
+	}
+	a, err := os.Open(args[1])
+	if err != nil {
+		return errors.Wrap(err, "opening manifest")
+	}
+	defer a.Close()
+	b, err := os.Open(args[2])
+	if err != nil {
+		return errors.Wrap(err, "opening manifest")
+	}
+	defer b.Close()
+
+	w := bufio.NewWriter(os.Stdout)
+	err = CompareManifests(a, b, func(c ManifestChange) error {
+		_, err := fmt.Fprintln(w, c)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(w.Flush(), "writing manifest changes")
+}
@@ -0,0 +1,64 @@
+package debdiff
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// algorithmCheck is a manifestSource that fails on an entry tagged with an
+// algorithm other than the current one. Untagged entries are passed through.
+type algorithmCheck struct {
+	manifestSource
+	ad *DebDiff
+}
+
+func (c algorithmCheck) next() (ManifestEntry, bool, error) {
+	e, ok, err := c.manifestSource.next()
+	if ok && e.Algorithm != "" && e.Algorithm != c.ad.hashAlgorithm() {
+		return ManifestEntry{}, false, errors.Errorf(
+			"manifest %s was written with %s, not %s",
+			c.ad.ManifestIn, e.Algorithm, c.ad.hashDescription())
+	}
+	return e, ok, err
+}
+
+// hashDescription describes the current hash in terms of the flags that
+// select it.
+func (ad *DebDiff) hashDescription() string {
+	if ad.hmacKey != nil {
+		return "the -hmac-key HMAC-SHA256"
+	}
+	return "-hash=" + strings.ToLower(ad.hashAlgorithm())
+}
+
+// buildManifestDiff compares the walked files against the ManifestIn
+// manifest, recording the files added, removed or changed since it was
+// written.
+func (ad *DebDiff) buildManifestDiff(ctx context.Context) error {
+	if ad.ManifestIn == "" {
+		return nil
+	}
+	f, err := os.Open(ad.ManifestIn)
+	if err != nil {
+		return errors.Wrap(err, "opening manifest")
+	}
+	defer f.Close()
+	entries, err := ad.manifestEntries(ctx)
+	if err != nil {
+		return err
+	}
+	saved := algorithmCheck{newManifestReader(f), ad}
+	current := entryList(entries)
+	return compareManifests(saved, &current, func(c ManifestChange) error {
+		// an untagged manifest only shows the wrong hash by its length
+		if c.Kind == ManifestChanged && len(c.OldHash) != len(c.NewHash) {
+			return errors.Errorf(
+				"manifest %s was not written with %s", ad.ManifestIn, ad.hashDescription())
+		}
+		ad.manifestDiff = append(ad.manifestDiff, c)
+		return nil
+	})
+}
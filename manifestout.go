@@ -0,0 +1,98 @@
+package debdiff
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// manifestEntries hashes the walked regular files, up to Jobs at a time,
+// returning them sorted by path. The paths are as seen from within the root.
+// Files that cannot be read due to permissions, or that were removed since
+// the walk, are left out.
+func (ad *DebDiff) manifestEntries(ctx context.Context) ([]ManifestEntry, error) {
+	entries := make([]ManifestEntry, len(ad.allFile))
+	errs := make([]error, len(ad.allFile))
+	err := ad.forEach(ctx, len(ad.allFile), func(i int) {
+		entries[i], errs[i] = ad.manifestEntry(ad.allFile[i])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := entries[:0]
+	for i, e := range entries {
+		if errs[i] != nil {
+			if err := ad.collect(errs[i]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if e.Hash != "" {
+			res = append(res, e)
+		}
+	}
+	if ad.NoSort {
+		sort.Slice(res, func(i, j int) bool { return res[i].Path < res[j].Path })
+	}
+	return res, nil
+}
+
+// manifestEntry hashes a walked file. The entry is empty if the file is not a
+// regular file or should be skipped.
+func (ad *DebDiff) manifestEntry(file string) (ManifestEntry, error) {
+	info, err := ad.statPath(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ManifestEntry{}, nil
+		}
+		if os.IsPermission(err) {
+			ad.skip(err)
+			return ManifestEntry{}, nil
+		}
+		return ManifestEntry{}, errors.Wrap(err, "writing manifest")
+	}
+	if !info.Mode().IsRegular() {
+		return ManifestEntry{}, nil
+	}
+	sum, err := ad.filehash(ad.rootPath(file))
+	if err != nil {
+		cause := errors.Cause(err)
+		if os.IsNotExist(cause) {
+			return ManifestEntry{}, nil
+		}
+		if os.IsPermission(cause) {
+			ad.skip(err)
+			return ManifestEntry{}, nil
+		}
+		return ManifestEntry{}, err
+	}
+	return ManifestEntry{Algorithm: ad.hashAlgorithm(), Hash: sum, Path: file}, nil
+}
+
+// writeManifest writes the manifest of the walked files to path, in the BSD
+// style format of the coreutils *sum tools with --tag, using the configured
+// hash.
+func (ad *DebDiff) writeManifest(ctx context.Context, path string) error {
+	entries, err := ad.manifestEntries(ctx)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "writing manifest")
+	}
+	w := bufio.NewWriter(f)
+	for _, e := range entries {
+		fmt.Fprintln(w, e)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return errors.Wrap(err, "writing manifest")
+	}
+	return errors.Wrap(f.Close(), "writing manifest")
+}
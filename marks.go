@@ -0,0 +1,97 @@
+package debdiff
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/daaku/debdiff/aptmark"
+)
+
+// markDiff is a package whose apt-mark state differs from the expected.
+type markDiff struct {
+	Package string
+	Mark    aptmark.Mark
+	// Unexpected is true if the mark is present but not expected, and false if
+	// it is expected but missing.
+	Unexpected bool
+}
+
+func (m markDiff) String() string {
+	if m.Unexpected {
+		return fmt.Sprintf("%s: unexpected %s", m.Package, m.Mark)
+	}
+	return fmt.Sprintf("%s: missing %s", m.Package, m.Mark)
+}
+
+// readExpectedMarks reads a file of "package mark" lines.
+func readExpectedMarks(path string) (map[aptmark.Mark][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading marks file")
+	}
+	defer f.Close()
+
+	res := make(map[aptmark.Mark][]string)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || fields[0][0] == '#' {
+			continue
+		}
+		if len(fields) != 2 || !aptmark.Mark(fields[1]).Valid() {
+			return nil, errors.Errorf("invalid marks line: %q", sc.Text())
+		}
+		m := aptmark.Mark(fields[1])
+		res[m] = append(res[m], fields[0])
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading marks file")
+	}
+	return res, nil
+}
+
+// buildMarkDiff compares the apt-mark states of the root against the
+// MarksFrom file.
+// Holds are always compared, so a file without any holds reports every held
+// package. The auto and manual marks are only compared if they are present in
+// the file.
+func (ad *DebDiff) buildMarkDiff(ctx context.Context) error {
+	if ad.MarksFrom == "" {
+		return nil
+	}
+	expected, err := readExpectedMarks(ad.MarksFrom)
+	if err != nil {
+		return err
+	}
+	for _, m := range []aptmark.Mark{aptmark.Hold, aptmark.Auto, aptmark.Manual} {
+		want, ok := expected[m]
+		if !ok && m != aptmark.Hold {
+			continue
+		}
+		sort.Strings(want)
+		actual, err := aptmark.ShowRoot(ad.Root, m)
+		if err != nil {
+			return err
+		}
+		for _, pkg := range actual {
+			if !contains(want, pkg) {
+				ad.markDiff = append(ad.markDiff, markDiff{pkg, m, true})
+			}
+		}
+		for _, pkg := range want {
+			if !contains(actual, pkg) {
+				ad.markDiff = append(ad.markDiff, markDiff{pkg, m, false})
+			}
+		}
+	}
+	sort.SliceStable(ad.markDiff, func(i, j int) bool {
+		return ad.markDiff[i].Package < ad.markDiff[j].Package
+	})
+	return nil
+}
@@ -0,0 +1,196 @@
+package debdiff
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// pkgSum is the checksum dpkg recorded for a packaged file.
+type pkgSum struct {
+	Path    string
+	Sum     string
+	Package string
+}
+
+// readMd5sums reads the checksums dpkg recorded in the *.md5sums files, at
+// the paths the dpkg diversions moved them to. The result is sorted by path.
+func (ad *DebDiff) readMd5sums() ([]pkgSum, error) {
+	lists, err := filepath.Glob(ad.dpkgInfoDir() + "/*.md5sums")
+	if err != nil {
+		return nil, errors.Wrap(err, "looking for dpkg md5sums")
+	}
+	diversions, err := readDiversions(filepath.Join(ad.Root, "var/lib/dpkg/diversions"))
+	if err != nil {
+		return nil, err
+	}
+	var res []pkgSum
+	for _, list := range lists {
+		sums, err := readMd5sumsFile(list)
+		if err != nil {
+			return nil, err
+		}
+		for i, sum := range sums {
+			sums[i].Path = diverted(diversions, sum.Path, sum.Package)
+		}
+		res = append(res, sums...)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Path < res[j].Path })
+	return res, nil
+}
+
+func readMd5sumsFile(list string) ([]pkgSum, error) {
+	f, err := os.Open(list)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading dpkg md5sums file")
+	}
+	defer f.Close()
+
+	base := filepath.Base(list)
+	pkg := base[:len(base)-len(filepath.Ext(base))]
+	var res []pkgSum
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// lines are "sum  relative/path"
+		l := sc.Bytes()
+		i := bytes.IndexByte(l, ' ')
+		if i == -1 {
+			return nil, errors.Errorf("invalid md5sums line in %s: %q", list, l)
+		}
+		res = append(res, pkgSum{
+			Path:    "/" + string(bytes.TrimLeft(l[i:], " ")),
+			Sum:     string(l[:i]),
+			Package: pkg,
+		})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading dpkg md5sums file")
+	}
+	return res, nil
+}
+
+// The statuses of a packaged file, as reported by debsums.
+const (
+	sumOK      = "OK"
+	sumFailed  = "FAILED"
+	sumMissing = "MISSING"
+)
+
+// pkgSumStatus is the result of checking a packaged file.
+type pkgSumStatus struct {
+	pkgSum
+	Status string
+}
+
+// checkPkgSums compares the packaged files to the checksums dpkg recorded.
+// Ignored files and files that can't be read due to permissions are skipped.
+func (ad *DebDiff) checkPkgSums(ctx context.Context) ([]pkgSumStatus, error) {
+	sums, err := ad.readMd5sums()
+	if err != nil {
+		return nil, err
+	}
+	var res []pkgSumStatus
+	for _, sum := range sums {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if ad.IsIgnored(sum.Path) {
+			continue
+		}
+		path := filepath.Join(ad.Root, sum.Path)
+		status := sumOK
+		actual, err := ad.hashWith(md5.New, path)
+		if err != nil {
+			cause := errors.Cause(err)
+			if os.IsPermission(cause) {
+				ad.skip(err)
+				continue
+			}
+			switch {
+			case cause == errSpecialFile:
+				// replaced by a device, FIFO or socket
+				status = sumFailed
+			case os.IsNotExist(cause):
+				status = sumMissing
+			default:
+				if err := ad.collect(err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		} else if actual != sum.Sum {
+			status = sumFailed
+		}
+		res = append(res, pkgSumStatus{pkgSum: sum, Status: status})
+	}
+	return res, nil
+}
+
+// modifiedPkgFiles returns the packaged files whose content no longer matches
+// the checksum dpkg recorded. Missing files are not included.
+func (ad *DebDiff) modifiedPkgFiles(ctx context.Context) ([]pkgSum, error) {
+	checked, err := ad.checkPkgSums(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var res []pkgSum
+	for _, c := range checked {
+		if c.Status == sumFailed {
+			res = append(res, c.pkgSum)
+		}
+	}
+	return res, nil
+}
+
+// buildUnapprovedFile finds the modified packaged files that are not
+// sanctioned by being present in the repo.
+func (ad *DebDiff) buildUnapprovedFile(ctx context.Context) error {
+	modified, err := ad.modifiedPkgFiles(ctx)
+	if err != nil {
+		return err
+	}
+	for _, sum := range modified {
+		if !ad.has(ad.repoFile, sum.Path) {
+			ad.unapprovedFile = append(ad.unapprovedFile, sum.Path)
+		}
+	}
+	return nil
+}
+
+// buildModifiedPkgFile finds the packaged files whose content differs from
+// what dpkg recorded, similar to debsums.
+func (ad *DebDiff) buildModifiedPkgFile(ctx context.Context) error {
+	if !ad.VerifyPkg && ad.Format != formatDebsums {
+		return nil
+	}
+	checked, err := ad.checkPkgSums(ctx)
+	if err != nil {
+		return err
+	}
+	for _, c := range checked {
+		if c.Status == sumFailed {
+			ad.modifiedPkgFile = append(ad.modifiedPkgFile, c.Path)
+		}
+	}
+	ad.sortStrings(ad.modifiedPkgFile)
+	if ad.Format == formatDebsums {
+		ad.pkgSums = checked
+	}
+	return nil
+}
+
+// writeDebsums writes the status of each checked packaged file in the format
+// used by debsums.
+func (ad *DebDiff) writeDebsums(w io.Writer) {
+	for _, c := range ad.pkgSums {
+		ad.emit(w, fmt.Sprintf("%-77s %s", ad.displayRel(c.Path), c.Status))
+	}
+}
@@ -0,0 +1,34 @@
+package debdiff
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestCheckPkgSumsDiverted(t *testing.T) {
+	sum := func(s string) string { return fmt.Sprintf("%x", md5.Sum([]byte(s))) }
+	ad := testDebDiff(t, map[string]string{
+		"usr/bin/tool":                  "local",
+		"usr/bin/tool.distrib":          "orig",
+		"usr/bin/own":                   "own",
+		"var/lib/dpkg/info/pkg.md5sums": sum("orig") + "  usr/bin/tool\n" + sum("own") + "  usr/bin/own\n",
+		"var/lib/dpkg/diversions": "/usr/bin/tool\n/usr/bin/tool.distrib\n:\n" +
+			"/usr/bin/own\n/usr/bin/own.distrib\npkg\n",
+	}, nil)
+	checked, err := ad.checkPkgSums(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, c := range checked {
+		got[c.Path] = c.Status
+	}
+	// a package's own diversion does not move its files
+	want := map[string]string{"/usr/bin/tool.distrib": sumOK, "/usr/bin/own": sumOK}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
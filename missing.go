@@ -0,0 +1,47 @@
+package debdiff
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// buildMissingPkgFile finds the packaged files that no longer exist. As the
+// file lists don't say which entries are directories, a missing entry that is
+// the parent of another packaged path is assumed to be a directory and is not
+// reported.
+func (ad *DebDiff) buildMissingPkgFile(ctx context.Context) error {
+	if !ad.Missing {
+		return nil
+	}
+	dirs := make(stringSet)
+	for _, file := range ad.pkgFile {
+		dirs[filepath.Dir(file)] = struct{}{}
+	}
+	for _, file := range ad.pkgFile {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if dirs.Contains(file) {
+			continue
+		}
+		if ad.IsIgnored(file) {
+			continue
+		}
+		_, err := os.Lstat(ad.rootPath(file))
+		if err == nil {
+			continue
+		}
+		if os.IsPermission(err) {
+			ad.skip(err)
+			continue
+		}
+		if !os.IsNotExist(err) {
+			return errors.Wrap(err, "checking packaged file")
+		}
+		ad.missingPkgFile = append(ad.missingPkgFile, file)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package debdiff
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// modeDrift is a file whose on disk permissions differ from the expected.
+type modeDrift struct {
+	Path     string
+	Expected uint32
+	Actual   uint32
+}
+
+func (m modeDrift) String() string {
+	return fmt.Sprintf("%s expected=%04o actual=%04o",
+		m.Path, m.Expected, m.Actual)
+}
+
+// unixMode converts the permission and special bits of a os.FileMode into
+// the traditional octal representation.
+func unixMode(m os.FileMode) uint32 {
+	res := uint32(m.Perm())
+	if m&os.ModeSetuid != 0 {
+		res |= 04000
+	}
+	if m&os.ModeSetgid != 0 {
+		res |= 02000
+	}
+	if m&os.ModeSticky != 0 {
+		res |= 01000
+	}
+	return res
+}
+
+// buildModeDrift compares the modes captured during the walk against those
+// listed in the ModesFrom file, which contains lines of "octal-mode path".
+func (ad *DebDiff) buildModeDrift(ctx context.Context) error {
+	if ad.ModesFrom == "" {
+		return nil
+	}
+	f, err := os.Open(ad.ModesFrom)
+	if err != nil {
+		return errors.Wrap(err, "reading modes file")
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		l := strings.TrimSpace(sc.Text())
+		if len(l) == 0 || l[0] == '#' {
+			continue
+		}
+		parts := strings.SplitN(l, " ", 2)
+		if len(parts) != 2 {
+			return errors.Errorf("invalid modes line: %q", l)
+		}
+		expected, err := strconv.ParseUint(parts[0], 8, 32)
+		if err != nil {
+			return errors.Wrapf(err, "invalid mode in line: %q", l)
+		}
+		path := filepath.Join("/", strings.TrimSpace(parts[1]))
+		info, ok := ad.fileInfo[path]
+		if !ok {
+			// not walked, either ignored or missing
+			continue
+		}
+		if actual := unixMode(info.Mode()); actual != uint32(expected) {
+			ad.modeDrift = append(ad.modeDrift, modeDrift{
+				Path:     path,
+				Expected: uint32(expected),
+				Actual:   actual,
+			})
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return errors.Wrap(err, "reading modes file")
+	}
+	sort.Slice(ad.modeDrift, func(i, j int) bool {
+		return ad.modeDrift[i].Path < ad.modeDrift[j].Path
+	})
+	return nil
+}
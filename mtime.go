@@ -0,0 +1,91 @@
+package debdiff
+
+import (
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// statPath returns the info captured during the walk, falling back to
+// checking the file system.
+func (ad *DebDiff) statPath(path string) (os.FileInfo, error) {
+	if info, ok := ad.fileInfo[path]; ok {
+		return info, nil
+	}
+	return os.Lstat(ad.rootPath(path))
+}
+
+// formatTime formats t as RFC3339, in UTC unless local time was requested.
+func (ad *DebDiff) formatTime(t time.Time) string {
+	if ad.LocalTime {
+		return t.Local().Format(time.RFC3339)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// annotate appends the modification time of path to line if enabled, using
+// "-" if it cannot be determined. When filtering by creation time, both the
+// creation and modification times are included.
+func (ad *DebDiff) annotate(path, line string) string {
+	if ad.CreatedSince > 0 {
+		btime := "-"
+		if t, ok, err := birthTime(ad.rootPath(path)); err == nil && ok {
+			btime = ad.formatTime(t)
+		}
+		mtime := "-"
+		if info, err := ad.statPath(path); err == nil {
+			mtime = ad.formatTime(info.ModTime())
+		}
+		return line + "\tbtime=" + btime + "\tmtime=" + mtime
+	}
+	if !ad.MTime {
+		return line
+	}
+	info, err := ad.statPath(path)
+	if err != nil {
+		return line + "\t-"
+	}
+	return line + "\t" + ad.formatTime(info.ModTime())
+}
+
+// filterCreatedSince keeps the unpackaged files created within CreatedSince.
+// Files whose creation time isn't available, or can't be read due to
+// permissions, are kept, as mtime could have been backdated and isn't a safe
+// substitute.
+func (ad *DebDiff) filterCreatedSince() error {
+	if ad.CreatedSince <= 0 {
+		return nil
+	}
+	since := time.Now().Add(-ad.CreatedSince)
+	var warned bool
+	res := ad.unpackagedFile[:0]
+	for _, file := range ad.unpackagedFile {
+		t, ok, err := birthTime(ad.rootPath(file))
+		if err != nil {
+			if os.IsNotExist(errors.Cause(err)) {
+				continue
+			}
+			if os.IsPermission(errors.Cause(err)) {
+				ad.skip(err)
+				res = append(res, file)
+				continue
+			}
+			return err
+		}
+		if !ok {
+			if !warned && !ad.Silent {
+				ad.logf("Creation time not available for %s, "+
+					"not filtering such files", file)
+				warned = true
+			}
+			res = append(res, file)
+			continue
+		}
+		if t.After(since) {
+			res = append(res, file)
+		}
+	}
+	ad.unpackagedFile = res
+	return nil
+}
@@ -0,0 +1,59 @@
+package debdiff
+
+import "sort"
+
+// The orders for the printed files.
+const (
+	sortPath    = "path"
+	sortSize    = "size"
+	sortPackage = "package"
+)
+
+// diffLine is a printed file, along with what it can be sorted by.
+type diffLine struct {
+	File  string // the path relative to the root
+	Line  string
+	Color string
+}
+
+// sortLines orders the lines by Sort, falling back to the line itself for
+// ties, and reverses them with Reverse.
+func (ad *DebDiff) sortLines(lines []diffLine) {
+	if ad.NoSort {
+		return
+	}
+	var less func(a, b diffLine) bool
+	switch ad.Sort {
+	case sortSize:
+		sizes := make(map[string]int64, len(lines))
+		for _, l := range lines {
+			sizes[l.File] = -1
+			if info, err := ad.statPath(l.File); err == nil {
+				sizes[l.File] = info.Size()
+			}
+		}
+		less = func(a, b diffLine) bool {
+			if sizes[a.File] != sizes[b.File] {
+				return sizes[a.File] < sizes[b.File]
+			}
+			return a.Line < b.Line
+		}
+	case sortPackage:
+		less = func(a, b diffLine) bool {
+			pa, pb := ad.packageOf(a.File), ad.packageOf(b.File)
+			if pa != pb {
+				// like with GroupByPackage, unpackaged files come last
+				return pb == unpackagedGroup || (pa != unpackagedGroup && pa < pb)
+			}
+			return a.Line < b.Line
+		}
+	default:
+		less = func(a, b diffLine) bool { return a.Line < b.Line }
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		if ad.Reverse {
+			return less(lines[j], lines[i])
+		}
+		return less(lines[i], lines[j])
+	})
+}
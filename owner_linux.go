@@ -0,0 +1,14 @@
+package debdiff
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the numeric owner and group of the file.
+func fileOwner(info os.FileInfo) (uint32, uint32, bool) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Uid, st.Gid, true
+	}
+	return 0, 0, false
+}
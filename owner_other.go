@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package debdiff
+
+import "os"
+
+// fileOwner is only supported on linux.
+func fileOwner(info os.FileInfo) (uint32, uint32, bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,123 @@
+package debdiff
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// pathsBoth prints the absolute root and repo paths for differing repo files.
+const pathsBoth = "both"
+
+// bothPaths returns the tab separated root and repo paths for a repo file,
+// using "-" for a side where it doesn't exist.
+func (ad *DebDiff) bothPaths(file string) string {
+	return existingPath(ad.rootPath(file)) +
+		"\t" +
+		existingPath(ad.repoPath(file))
+}
+
+func existingPath(path string) string {
+	if _, err := os.Lstat(path); err != nil {
+		return "-"
+	}
+	return shellQuoteIfNeeded(path)
+}
+
+// rootPath returns the path on disk of a file relative to the root.
+func (ad *DebDiff) rootPath(file string) string {
+	return filepath.Join(ad.Root, rawPath(ad.rootRaw, file))
+}
+
+// maxSymlinks bounds the symlinks followed by statIn, like the kernel does.
+const maxSymlinks = 40
+
+// statIn is os.Stat for a path within the tree at dir, resolving absolute
+// symlink targets under dir as if it were "/", and never leaving it with "..".
+func statIn(dir, path string) (os.FileInfo, error) {
+	resolved := "/"
+	pending := strings.Split(path, "/")
+	var links int
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+		next := filepath.Join(resolved, name)
+		info, err := os.Lstat(filepath.Join(dir, next))
+		if err != nil {
+			return nil, err
+		}
+		if !isSymlink(info) {
+			resolved = next
+			continue
+		}
+		if links++; links > maxSymlinks {
+			return nil, &os.PathError{Op: "stat", Path: filepath.Join(dir, path), Err: syscall.ELOOP}
+		}
+		target, err := os.Readlink(filepath.Join(dir, next))
+		if err != nil {
+			return nil, err
+		}
+		if filepath.IsAbs(target) {
+			resolved = "/"
+		}
+		pending = append(strings.Split(target, "/"), pending...)
+	}
+	return os.Lstat(filepath.Join(dir, resolved))
+}
+
+// display returns the path on disk of a walked file, or places it under
+// DisplayRoot, or with Relative leaves it as seen from within the root.
+func (ad *DebDiff) display(file string) string {
+	if ad.Relative {
+		return file
+	}
+	if ad.DisplayRoot != "" {
+		return ad.displayRel(file)
+	}
+	return filepath.Join(ad.Root, file)
+}
+
+// displayDisk is display for a path on disk, which may be outside the root.
+func (ad *DebDiff) displayDisk(path string) string {
+	root := strings.TrimSuffix(ad.Root, "/")
+	if root != "" && path != root && !strings.HasPrefix(path, root+"/") {
+		return path
+	}
+	return ad.display("/" + strings.TrimPrefix(strings.TrimPrefix(path, root), "/"))
+}
+
+// displayRel places a path relative to the root under DisplayRoot.
+func (ad *DebDiff) displayRel(file string) string {
+	if ad.DisplayRoot == "" {
+		return file
+	}
+	return filepath.Join(ad.DisplayRoot, file)
+}
+
+// withPackage prefixes the line with the package owning the file when
+// ShowPackage is enabled and the file is packaged.
+func (ad *DebDiff) withPackage(file, line string) string {
+	if !ad.ShowPackage {
+		return line
+	}
+	if o, ok := ad.pkgOwner[file]; ok && o.Package != "" {
+		return o.Package + ": " + line
+	}
+	return line
+}
+
+// classify prefixes the line with the status when Classify is enabled.
+func (ad *DebDiff) classify(status, line string) string {
+	if !ad.Classify {
+		return line
+	}
+	return status + " " + line
+}
@@ -0,0 +1,34 @@
+package debdiff
+
+import "testing"
+
+func TestDisplay(t *testing.T) {
+	cases := []struct {
+		name        string
+		root        string
+		displayRoot string
+		relative    bool
+		fn          func(ad *DebDiff, path string) string
+		path        string
+		want        string
+	}{
+		{"root", "/mnt", "", false, (*DebDiff).display, "/etc/a", "/mnt/etc/a"},
+		{"relative", "/mnt", "", true, (*DebDiff).display, "/etc/a", "/etc/a"},
+		{"display root", "/mnt", "/target", false, (*DebDiff).display, "/etc/a", "/target/etc/a"},
+		{"relative wins", "/mnt", "/target", true, (*DebDiff).display, "/etc/a", "/etc/a"},
+		{"rel", "/mnt", "", false, (*DebDiff).displayRel, "/etc/a", "/etc/a"},
+		{"rel display root", "/mnt", "/target", false, (*DebDiff).displayRel, "/etc/a", "/target/etc/a"},
+		{"disk", "/mnt", "/target", false, (*DebDiff).displayDisk, "/mnt/etc/a", "/target/etc/a"},
+		{"disk root", "/mnt", "/target", false, (*DebDiff).displayDisk, "/mnt", "/target"},
+		{"disk trailing slash", "/mnt/", "/target", false, (*DebDiff).displayDisk, "/mnt/etc/a", "/target/etc/a"},
+		{"disk outside", "/mnt", "/target", false, (*DebDiff).displayDisk, "/mntx/etc/a", "/mntx/etc/a"},
+		{"disk relative", "/mnt", "", true, (*DebDiff).displayDisk, "/mnt/etc/a", "/etc/a"},
+		{"disk no display root", "/mnt", "", false, (*DebDiff).displayDisk, "/mnt/etc/a", "/mnt/etc/a"},
+	}
+	for _, c := range cases {
+		ad := &DebDiff{Root: c.root, DisplayRoot: c.displayRoot, Relative: c.relative}
+		if got := c.fn(ad, c.path); got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
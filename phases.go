@@ -0,0 +1,107 @@
+package debdiff
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// step is a single build step.
+type step func(ctx context.Context) error
+
+// phase is a set of independent steps that can run concurrently.
+type phase []step
+
+// runPhases runs the phases in order, and the steps within each phase
+// concurrently. All the steps of a phase are waited for before returning, and
+// the cause of the first error is returned. With FailFast the context given to the
+// other steps is canceled on the first error so they return promptly.
+func (ad *DebDiff) runPhases(ctx context.Context, phases []phase) error {
+	for _, p := range phases {
+		var g *errgroup.Group
+		pctx := ctx
+		if ad.FailFast {
+			g, pctx = errgroup.WithContext(ctx)
+		} else {
+			g = new(errgroup.Group)
+		}
+		for _, s := range p {
+			s := s
+			g.Go(func() error {
+				start := time.Now()
+				err := s(pctx)
+				if ad.Verbose {
+					ad.logStep(s, time.Since(start))
+				}
+				return err
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return errors.Cause(err)
+		}
+	}
+	return nil
+}
+
+// forEach calls fn with each index below n, up to Jobs at a time. It stops
+// handing out indexes once ctx is done, and returns its error.
+func (ad *DebDiff) forEach(ctx context.Context, n int, fn func(i int)) error {
+	var g errgroup.Group
+	g.SetLimit(ad.jobs())
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		g.Go(func() error {
+			if ctx.Err() == nil {
+				fn(i)
+			}
+			return nil
+		})
+	}
+	g.Wait()
+	return ctx.Err()
+}
+
+// stepCounts return the number of items produced by a step, by the step name.
+var stepCounts = map[string]func(ad *DebDiff) int{
+	"buildIgnoreGlob":      func(ad *DebDiff) int { return len(ad.ignoreGlob) },
+	"buildAllFile":         metrics["all"],
+	"buildRepoFile":        metrics["repo"],
+	"buildPkgFile":         metrics["pkg"],
+	"buildAlternateFile":   metrics["alternate"],
+	"buildMarkDiff":        metrics["markDiff"],
+	"buildUnpackagedFile":  metrics["unpackaged"],
+	"buildDiffRepoFile":    metrics["diffRepo"],
+	"buildModeDrift":       metrics["modeDrift"],
+	"buildCapsDiff":        metrics["capsDiff"],
+	"buildModifiedPkgFile": metrics["modifiedPkg"],
+	"buildMissingPkgFile":  metrics["missingPkg"],
+	"buildBrokenSymlink":   metrics["brokenSymlink"],
+	"buildWorldWritable":   metrics["worldWritable"],
+	"buildUnapprovedFile":  metrics["unapproved"],
+	"buildAltOrphans":      metrics["altOrphan"],
+	"buildAltDiff":         metrics["altDiff"],
+	"buildFilelessPkg":     metrics["filelessPkg"],
+	"buildRenamedFile":     metrics["renamed"],
+	"buildManifestDiff":    metrics["manifestDiff"],
+}
+
+// stepName returns the name of the method implementing the step.
+func stepName(s step) string {
+	name := runtime.FuncForPC(reflect.ValueOf(s).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	return name[strings.LastIndexByte(name, '.')+1:]
+}
+
+// logStep logs how long the step took, and how many items it produced.
+func (ad *DebDiff) logStep(s step, d time.Duration) {
+	name := stepName(s)
+	if count, ok := stepCounts[name]; ok {
+		ad.logf("%s took %s, %d items", name, d, count(ad))
+		return
+	}
+	ad.logf("%s took %s", name, d)
+}
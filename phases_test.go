@@ -0,0 +1,141 @@
+package debdiff
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestRunPhasesFailFast(t *testing.T) {
+	before := runtime.NumGoroutine()
+	errStep := errors.New("step failed")
+	var canceled, ranNext bool
+	ad := &DebDiff{FailFast: true}
+	err := ad.runPhases(context.Background(), []phase{
+		{
+			func(ctx context.Context) error {
+				return errors.Wrap(errStep, "wrapped")
+			},
+			func(ctx context.Context) error {
+				select {
+				case <-ctx.Done():
+					canceled = true
+				case <-time.After(10 * time.Second):
+				}
+				return ctx.Err()
+			},
+		},
+		{
+			func(ctx context.Context) error {
+				ranNext = true
+				return nil
+			},
+		},
+	})
+	if err != errStep {
+		t.Fatalf("got error %v, want the cause %v", err, errStep)
+	}
+	if !canceled {
+		t.Fatal("the blocked step was not canceled")
+	}
+	if ranNext {
+		t.Fatal("the next phase ran after the failure")
+	}
+
+	// the goroutines of the steps may take a moment to exit
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Fatalf("%d goroutines leaked", n-before)
+	}
+}
+
+// TestRunConcurrent runs the concurrent phases over a fixture, and is meant to
+// also be run with -race.
+func TestRunConcurrent(t *testing.T) {
+	root := make(map[string]string)
+	repo := make(map[string]string)
+	var packaged []string
+	for i := 0; i < 50; i++ {
+		dir := fmt.Sprintf("etc/d%d", i%5)
+		root[fmt.Sprintf("%s/unpackaged%d", dir, i)] = "u"
+		root[fmt.Sprintf("%s/pkg%d", dir, i)] = "p"
+		packaged = append(packaged, fmt.Sprintf("/%s/pkg%d", dir, i))
+		root[fmt.Sprintf("%s/repo%d", dir, i)] = "r"
+		repo[fmt.Sprintf("%s/repo%d", dir, i)] = "r"
+		root[fmt.Sprintf("%s/diff%d", dir, i)] = "old"
+		repo[fmt.Sprintf("%s/diff%d", dir, i)] = "new"
+	}
+	ad := testDebDiff(t, root, repo, append([]string{"/etc"}, packaged...)...)
+
+	ad.Jobs = 1
+	serial, err := ad.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ad.Jobs = 8
+	for i := 0; i < 3; i++ {
+		res, err := ad.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(res, serial) {
+			t.Fatalf("run %d differs from the serial run", i)
+		}
+	}
+	if len(serial.UnpackagedFile) != 50 || len(serial.DiffRepoFile) != 50 {
+		t.Fatalf("got %d unpackaged and %d differing files, want 50 each",
+			len(serial.UnpackagedFile), len(serial.DiffRepoFile))
+	}
+}
+
+func TestForEach(t *testing.T) {
+	ad := &DebDiff{Jobs: 3}
+	var running, peak int32
+	seen := make([]int32, 100)
+	err := ad.forEach(context.Background(), len(seen), func(i int) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&seen[i], 1)
+		atomic.AddInt32(&running, -1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, n := range seen {
+		if n != 1 {
+			t.Fatalf("index %d was seen %d times", i, n)
+		}
+	}
+	if peak > 3 {
+		t.Fatalf("%d ran at a time, want at most 3", peak)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int32
+	err = ad.forEach(ctx, 100, func(i int) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	if calls > 3 {
+		t.Fatalf("%d calls after the cancel, want at most 3", calls)
+	}
+}
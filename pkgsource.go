@@ -0,0 +1,256 @@
+package debdiff
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PackageFile is a path owned by a package.
+type PackageFile struct {
+	Path    string
+	Package string
+}
+
+// PackageSource provides the paths owned by installed software.
+type PackageSource interface {
+	// Name identifies the source in the ownership information.
+	Name() string
+
+	// Files returns the paths owned by the packages installed under root.
+	Files(root string) ([]PackageFile, error)
+}
+
+// owner identifies the package, and the source it came from, that claimed a
+// path.
+type owner struct {
+	Source  string
+	Package string
+}
+
+// errNoDpkgInfo is returned by DpkgSource if the dpkg info directory doesn't
+// exist.
+var errNoDpkgInfo = errors.New("dpkg info directory does not exist")
+
+// DpkgSource provides the files listed in the dpkg info directory.
+type DpkgSource struct{}
+
+// Name returns "dpkg".
+func (DpkgSource) Name() string {
+	return "dpkg"
+}
+
+// Files returns the files in the *.list and *.conffiles files, which may be
+// gzipped, moved to where the dpkg diversions place them.
+func (DpkgSource) Files(root string) ([]PackageFile, error) {
+	infoDir := filepath.Join(root, "var/lib/dpkg/info")
+	if _, err := os.Stat(infoDir); err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.WithStack(errNoDpkgInfo)
+		}
+		return nil, errors.Wrap(err, "checking dpkg info directory")
+	}
+	var lists []string
+	for _, pattern := range []string{"*.list", "*.conffiles", "*.list.gz", "*.conffiles.gz"} {
+		matches, err := filepath.Glob(filepath.Join(infoDir, pattern))
+		if err != nil {
+			return nil, errors.Wrap(err, "looking for dpkg info lists")
+		}
+		lists = append(lists, matches...)
+	}
+	files, err := readFileLists(lists)
+	if err != nil {
+		return nil, err
+	}
+	diversions, err := readDiversions(filepath.Join(root, "var/lib/dpkg/diversions"))
+	if err != nil {
+		return nil, err
+	}
+	for i, file := range files {
+		files[i].Path = diverted(diversions, file.Path, file.Package)
+	}
+	return files, nil
+}
+
+// diverted returns where a path installed by pkg actually is, which is moved
+// by a diversion unless it was made by pkg itself.
+func diverted(diversions map[string]diversion, path, pkg string) string {
+	if d, ok := diversions[path]; ok && d.By != pkgName(pkg) {
+		return d.To
+	}
+	return path
+}
+
+// diversion is where dpkg-divert moved a path, and the package that did so or
+// ":" for a local diversion. The package itself still installs the path.
+type diversion struct {
+	To string
+	By string
+}
+
+// readDiversions reads the dpkg diversions database, which consists of three
+// lines for each diverted path. A missing database has no diversions.
+func readDiversions(path string) (map[string]diversion, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "reading dpkg diversions")
+	}
+	defer f.Close()
+
+	res := make(map[string]diversion)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		from := sc.Text()
+		var d diversion
+		if sc.Scan() {
+			d.To = sc.Text()
+		}
+		if !sc.Scan() {
+			return nil, errors.Errorf("truncated dpkg diversions in %s", path)
+		}
+		d.By = sc.Text()
+		res[from] = d
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading dpkg diversions")
+	}
+	return res, nil
+}
+
+// pkgName strips the architecture qualifier from a dpkg package name.
+func pkgName(pkg string) string {
+	if i := strings.IndexByte(pkg, ':'); i != -1 {
+		return pkg[:i]
+	}
+	return pkg
+}
+
+// OpkgSource provides the files listed in the opkg info directory, as used by
+// OpenWrt.
+type OpkgSource struct{}
+
+// Name returns "opkg".
+func (OpkgSource) Name() string {
+	return "opkg"
+}
+
+// Files returns the files in the *.list files.
+func (OpkgSource) Files(root string) ([]PackageFile, error) {
+	lists, err := filepath.Glob(filepath.Join(root, "usr/lib/opkg/info/*.list"))
+	if err != nil {
+		return nil, errors.Wrap(err, "looking for opkg info lists")
+	}
+	return readFileLists(lists)
+}
+
+// namedSources are the package sources that can be selected by name.
+var namedSources = map[string]PackageSource{
+	"dpkg": DpkgSource{},
+	"opkg": OpkgSource{},
+}
+
+// parseSources returns the package sources in the comma separated list of
+// names.
+func parseSources(names string) ([]PackageSource, error) {
+	var res []PackageSource
+	for _, name := range strings.Split(names, ",") {
+		source, ok := namedSources[strings.TrimSpace(name)]
+		if !ok {
+			return nil, errors.Errorf("unknown package source %q", name)
+		}
+		res = append(res, source)
+	}
+	return res, nil
+}
+
+// ListSource provides the files in plain text lists containing one path per
+// line. The package is the list file name without the extension, similar to
+// the dpkg lists.
+type ListSource struct {
+	Lists []string
+}
+
+// Name returns "list".
+func (ListSource) Name() string {
+	return "list"
+}
+
+// Files returns the files in all the lists. Relative lists are resolved to
+// the current directory and not the root.
+func (s ListSource) Files(root string) ([]PackageFile, error) {
+	return readFileLists(s.Lists)
+}
+
+// readFileLists reads lists of paths, one per line. The package is the list
+// file name without the extension. Lists ending in .gz are decompressed.
+func readFileLists(lists []string) ([]PackageFile, error) {
+	var res []PackageFile
+	for _, list := range lists {
+		files, err := readFileList(list)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, files...)
+	}
+	return res, nil
+}
+
+func readFileList(list string) ([]PackageFile, error) {
+	f, err := os.OpenFile(list, os.O_RDONLY, os.ModePerm)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading package file list")
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	base := filepath.Base(list)
+	if strings.HasSuffix(base, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading package file list %s", list)
+		}
+		defer zr.Close()
+		r = zr
+		base = strings.TrimSuffix(base, ".gz")
+	}
+
+	var res []PackageFile
+	pkg := strings.TrimSuffix(base, filepath.Ext(base))
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		// lists written on windows have CRLF line endings
+		path := strings.TrimSuffix(sc.Text(), "\r")
+		// dpkg lists start with "/." for the root itself, which is not a file
+		if path == "" || path == "/." {
+			continue
+		}
+		for strings.HasPrefix(path, "/./") {
+			path = path[2:]
+		}
+		res = append(res, PackageFile{Path: path, Package: pkg})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading package file list")
+	}
+	return res, nil
+}
+
+// stringList is a flag.Value that can be set multiple times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
@@ -0,0 +1,71 @@
+package debdiff
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestNoDpkgInfo(t *testing.T) {
+	if _, err := (DpkgSource{}).Files(t.TempDir()); errors.Cause(err) != errNoDpkgInfo {
+		t.Fatalf("got error %v, want %v", err, errNoDpkgInfo)
+	}
+
+	cases := []struct {
+		allow bool
+		err   string
+	}{
+		{allow: false, err: "use -allow-no-dpkg to continue without it"},
+		{allow: true},
+	}
+	for _, c := range cases {
+		ad := &DebDiff{Root: t.TempDir(), AllowNoDpkg: c.allow, Silent: true}
+		err := ad.buildPkgFile(context.Background())
+		if c.err == "" {
+			if err != nil {
+				t.Fatalf("allow %v: %v", c.allow, err)
+			}
+			if len(ad.pkgFile) != 0 {
+				t.Fatalf("allow %v: got packaged files %v", c.allow, ad.pkgFile)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("allow %v: got error %v, want %q", c.allow, err, c.err)
+		}
+	}
+}
+
+func TestReadFileListLineEndings(t *testing.T) {
+	want := []PackageFile{
+		{Path: "/etc", Package: "test"},
+		{Path: "/etc/a b", Package: "test"},
+		{Path: "/etc/c", Package: "test"},
+	}
+	cases := []struct {
+		name string
+		list string
+	}{
+		{"lf", "/.\n/etc\n/etc/a b\n/./etc/c\n"},
+		{"crlf", "/.\r\n/etc\r\n/etc/a b\r\n/./etc/c\r\n"},
+		{"crlf without final newline", "/.\r\n/etc\r\n\r\n/etc/a b\r\n/etc/c"},
+	}
+	for _, c := range cases {
+		list := filepath.Join(t.TempDir(), "test.list")
+		if err := os.WriteFile(list, []byte(c.list), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readFileList(list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q, want %q", c.name, got, want)
+		}
+	}
+}
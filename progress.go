@@ -0,0 +1,90 @@
+package debdiff
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progress counts the work done so far and periodically reports it.
+type progress struct {
+	walked int64
+	hashed int64
+	diffs  int64
+
+	w    io.Writer
+	tty  bool
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// startProgress starts reporting progress to w, which goes to stderr, every
+// interval. On a terminal a single line is rewritten, otherwise a line is
+// written each time.
+func startProgress(w io.Writer, interval time.Duration) *progress {
+	p := &progress{w: w, stop: make(chan struct{})}
+	if info, err := os.Stderr.Stat(); err == nil {
+		p.tty = info.Mode()&os.ModeCharDevice != 0
+	}
+	p.done.Add(1)
+	go func() {
+		defer p.done.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.report(false)
+			case <-p.stop:
+				p.report(true)
+				return
+			}
+		}
+	}()
+	return p
+}
+
+func (p *progress) report(final bool) {
+	line := fmt.Sprintf("walked %d, hashed %d, diffs %d",
+		atomic.LoadInt64(&p.walked),
+		atomic.LoadInt64(&p.hashed),
+		atomic.LoadInt64(&p.diffs))
+	if !p.tty {
+		fmt.Fprintln(p.w, line)
+		return
+	}
+	end := ""
+	if final {
+		end = "\n"
+	}
+	fmt.Fprintf(p.w, "\r\033[K%s%s", line, end)
+}
+
+// finish stops reporting after writing the final counts.
+func (p *progress) finish() {
+	close(p.stop)
+	p.done.Wait()
+}
+
+// The counters are no-ops when progress is not being reported.
+
+func (p *progress) walk() {
+	if p != nil {
+		atomic.AddInt64(&p.walked, 1)
+	}
+}
+
+func (p *progress) hash() {
+	if p != nil {
+		atomic.AddInt64(&p.hashed, 1)
+	}
+}
+
+func (p *progress) diff() {
+	if p != nil {
+		atomic.AddInt64(&p.diffs, 1)
+	}
+}
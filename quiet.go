@@ -0,0 +1,100 @@
+package debdiff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// maxHeldLog bounds the output a heldLog holds back, the rest is dropped.
+const maxHeldLog = 1024 * 1024
+
+// heldLog writes to stderr, holding back the output while holding until it is
+// known whether it should be shown.
+type heldLog struct {
+	mu      sync.Mutex
+	holding bool
+	buf     bytes.Buffer
+	dropped int
+}
+
+func (h *heldLog) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.holding {
+		return os.Stderr.Write(p)
+	}
+	if h.buf.Len()+len(p) > maxHeldLog {
+		h.dropped += len(p)
+		return len(p), nil
+	}
+	return h.buf.Write(p)
+}
+
+// start holds back the output, including that of the log package.
+func (h *heldLog) start() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.holding = true
+	log.SetOutput(h)
+}
+
+// flush writes out held output and stops holding.
+func (h *heldLog) flush() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	os.Stderr.Write(h.buf.Bytes())
+	if h.dropped > 0 {
+		fmt.Fprintf(os.Stderr, "(%d bytes of held output dropped)\n", h.dropped)
+	}
+	h.reset()
+}
+
+// discard drops held output and stops holding.
+func (h *heldLog) discard() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.reset()
+}
+
+func (h *heldLog) reset() {
+	log.SetOutput(os.Stderr)
+	h.holding = false
+	h.buf.Reset()
+	h.dropped = 0
+}
+
+// stderr is where diagnostics other than the log go, which is the held log
+// with QuietOnClean.
+func (ad *DebDiff) stderr() io.Writer {
+	if ad.held != nil {
+		return ad.held
+	}
+	return os.Stderr
+}
+
+// findings returns the number of reported results.
+func (ad *DebDiff) findings() int {
+	return len(ad.unpackagedFile) +
+		len(ad.diffRepoFile) +
+		len(ad.modeDrift) +
+		len(ad.markDiff) +
+		len(ad.worldWritable) +
+		len(ad.unapprovedFile) +
+		len(ad.capsDiff) +
+		len(ad.altOrphan) +
+		len(ad.altDiff) +
+		len(ad.nondeterministic) +
+		len(ad.filelessPkg) +
+		len(ad.modifiedPkgFile) +
+		len(ad.missingPkgFile) +
+		len(ad.repoOnlyFile) +
+		len(ad.brokenSymlink) +
+		len(ad.repoModeDiff) +
+		len(ad.repoOwnerDiff) +
+		len(ad.renamedFile) +
+		len(ad.manifestDiff)
+}
@@ -0,0 +1,28 @@
+package debdiff
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHeldLogCap(t *testing.T) {
+	var h heldLog
+	h.start()
+	defer h.discard()
+	line := bytes.Repeat([]byte("x"), 1024)
+	for i := 0; i < 2*maxHeldLog/len(line); i++ {
+		if n, err := h.Write(line); err != nil || n != len(line) {
+			t.Fatalf("got %d, %v", n, err)
+		}
+	}
+	if h.buf.Len() != maxHeldLog {
+		t.Fatalf("held %d bytes, want %d", h.buf.Len(), maxHeldLog)
+	}
+	if h.dropped != maxHeldLog {
+		t.Fatalf("dropped %d bytes, want %d", h.dropped, maxHeldLog)
+	}
+	h.discard()
+	if h.holding || h.buf.Len() != 0 || h.dropped != 0 {
+		t.Fatal("discard did not reset")
+	}
+}
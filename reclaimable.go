@@ -0,0 +1,101 @@
+package debdiff
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// humanBytes formats n using binary units, like "1.4 GiB".
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// dirUsage is the space used by the unpackaged files in a top level directory.
+type dirUsage struct {
+	Dir   string
+	Bytes int64
+	Files int
+}
+
+// topLevelDir returns the first component of a file relative to the root.
+func topLevelDir(file string) string {
+	rel := strings.TrimPrefix(file, "/")
+	if i := strings.IndexByte(rel, '/'); i > -1 {
+		rel = rel[:i]
+	}
+	return "/" + rel
+}
+
+// buildReclaimable sums the space used by the unpackaged files, either their
+// apparent size or with ActualBlocks the disk space actually allocated.
+func (ad *DebDiff) buildReclaimable(ctx context.Context) error {
+	byDir := make(map[string]*dirUsage)
+	for _, file := range ad.unpackagedFile {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		info, err := ad.statPath(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			if os.IsPermission(err) {
+				ad.skip(err)
+				continue
+			}
+			return errors.Wrap(err, "computing reclaimable space")
+		}
+		size := info.Size()
+		if ad.ActualBlocks {
+			size = diskUsage(info)
+		}
+		dir := topLevelDir(file)
+		u, ok := byDir[dir]
+		if !ok {
+			u = &dirUsage{Dir: dir}
+			byDir[dir] = u
+		}
+		u.Bytes += size
+		u.Files++
+	}
+	for _, u := range byDir {
+		ad.reclaimable = append(ad.reclaimable, *u)
+	}
+	sort.Slice(ad.reclaimable, func(i, j int) bool {
+		a, b := ad.reclaimable[i], ad.reclaimable[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.Dir < b.Dir
+	})
+	return nil
+}
+
+// writeReclaimable writes the per directory breakdown followed by the total.
+func (ad *DebDiff) writeReclaimable(w io.Writer) error {
+	var total int64
+	var files int
+	for _, u := range ad.reclaimable {
+		fmt.Fprintf(w, "%s\t%s\t%d files\n",
+			ad.displayRel(u.Dir), humanBytes(u.Bytes), u.Files)
+		total += u.Bytes
+		files += u.Files
+	}
+	_, err := fmt.Fprintf(w, "total\t%s\t%d files\n", humanBytes(total), files)
+	return err
+}
@@ -0,0 +1,110 @@
+package debdiff
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// renamedFile is a repo file missing from the root whose content was found in
+// an unpackaged file.
+type renamedFile struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (r renamedFile) String() string {
+	return fmt.Sprintf("%s: renamed from %s", r.To, r.From)
+}
+
+// fileSize returns the size of the regular file at path, or -1 if it is not
+// one or cannot be stat'd.
+func fileSize(path string) int64 {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return -1
+	}
+	return info.Size()
+}
+
+// buildRenamedFile pairs the repo files missing from the root with the
+// unpackaged files that have the same content, with DetectRenames. Only the
+// unpackaged files with the size of a missing repo file are hashed. Paired
+// files are removed from the repo only and unpackaged files.
+func (ad *DebDiff) buildRenamedFile(ctx context.Context) error {
+	if !ad.DetectRenames || len(ad.repoOnlyFile) == 0 {
+		return nil
+	}
+	sizes := make(map[int64]bool)
+	for _, file := range ad.repoOnlyFile {
+		if size := fileSize(ad.repoPath(file)); size >= 0 {
+			sizes[size] = true
+		}
+	}
+
+	// the missing repo files by hash, hashed as needed
+	byHash := make(map[string][]string)
+	hashed := false
+	hashRepoOnly := func() error {
+		for _, file := range ad.repoOnlyFile {
+			path := ad.repoPath(file)
+			if fileSize(path) < 0 {
+				continue
+			}
+			sum, err := ad.filehash(path)
+			if err != nil {
+				if os.IsPermission(errors.Cause(err)) {
+					ad.skip(err)
+					continue
+				}
+				if err := ad.collect(err); err != nil {
+					return err
+				}
+				continue
+			}
+			byHash[sum] = append(byHash[sum], file)
+		}
+		return nil
+	}
+
+	renamed := make(stringSet)
+	for _, file := range ad.unpackagedFile {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		path := ad.rootPath(file)
+		if !sizes[fileSize(path)] {
+			continue
+		}
+		if !hashed {
+			if err := hashRepoOnly(); err != nil {
+				return err
+			}
+			hashed = true
+		}
+		sum, err := ad.filehash(path)
+		if err != nil {
+			if os.IsPermission(errors.Cause(err)) {
+				ad.skip(err)
+				continue
+			}
+			if err := ad.collect(err); err != nil {
+				return err
+			}
+			continue
+		}
+		from := byHash[sum]
+		if len(from) == 0 {
+			continue
+		}
+		byHash[sum] = from[1:]
+		ad.renamedFile = append(ad.renamedFile, renamedFile{From: from[0], To: file})
+		renamed[from[0]] = struct{}{}
+		renamed[file] = struct{}{}
+	}
+	ad.repoOnlyFile = dropStrings(ad.repoOnlyFile, renamed.Contains)
+	ad.unpackagedFile = dropStrings(ad.unpackagedFile, renamed.Contains)
+	return nil
+}
@@ -0,0 +1,74 @@
+package debdiff
+
+import (
+	"fmt"
+	"os"
+)
+
+// repoModeDiff is a repo file whose permissions differ from the root.
+type repoModeDiff struct {
+	Path string
+	Root uint32
+	Repo uint32
+}
+
+func (m repoModeDiff) String() string {
+	return fmt.Sprintf("%s %04o != %04o", m.Path, m.Root, m.Repo)
+}
+
+// repoOwnerDiff is a repo file whose owner or group differs from the root.
+type repoOwnerDiff struct {
+	Path    string
+	RootUID uint32
+	RootGID uint32
+	RepoUID uint32
+	RepoGID uint32
+}
+
+func (o repoOwnerDiff) String() string {
+	return fmt.Sprintf("%s %d:%d != %d:%d",
+		o.Path, o.RootUID, o.RootGID, o.RepoUID, o.RepoGID)
+}
+
+// repoAttrs holds the attribute differences found for a repo file.
+type repoAttrs struct {
+	mode  *repoModeDiff
+	owner *repoOwnerDiff
+}
+
+// compareRepoAttrs compares the enabled attributes of the repo file and the
+// one in the root. Symlinks and files missing on either side are skipped.
+func (ad *DebDiff) compareRepoAttrs(file string) repoAttrs {
+	var res repoAttrs
+	if !ad.CheckMode && !ad.CheckOwner {
+		return res
+	}
+	rootinfo, err := os.Lstat(ad.rootPath(file))
+	if err != nil || isSymlink(rootinfo) {
+		return res
+	}
+	repoinfo, err := os.Lstat(ad.repoPath(file))
+	if err != nil || isSymlink(repoinfo) {
+		return res
+	}
+	if ad.CheckMode {
+		rootMode, repoMode := unixMode(rootinfo.Mode()), unixMode(repoinfo.Mode())
+		if rootMode != repoMode {
+			res.mode = &repoModeDiff{Path: file, Root: rootMode, Repo: repoMode}
+		}
+	}
+	if ad.CheckOwner {
+		rootUID, rootGID, rootOK := fileOwner(rootinfo)
+		repoUID, repoGID, repoOK := fileOwner(repoinfo)
+		if rootOK && repoOK && (rootUID != repoUID || rootGID != repoGID) {
+			res.owner = &repoOwnerDiff{
+				Path:    file,
+				RootUID: rootUID,
+				RootGID: rootGID,
+				RepoUID: repoUID,
+				RepoGID: repoGID,
+			}
+		}
+	}
+	return res
+}
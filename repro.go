@@ -0,0 +1,32 @@
+package debdiff
+
+import (
+	"hash"
+	"sort"
+)
+
+// hashWith hashes the file using newHash. With VerifyRepro the file is hashed
+// twice, and a file whose hashes differ is recorded as nondeterministic.
+func (ad *DebDiff) hashWith(newHash func() hash.Hash, path string) (string, error) {
+	ad.progress.hash()
+	sum, err := hashFile(newHash, path)
+	if err != nil || !ad.VerifyRepro {
+		return sum, err
+	}
+	again, err := hashFile(newHash, path)
+	if err != nil {
+		return "", err
+	}
+	if again != sum {
+		ad.nondeterministicMu.Lock()
+		ad.nondeterministic = append(ad.nondeterministic, path)
+		ad.nondeterministicMu.Unlock()
+	}
+	return sum, nil
+}
+
+// sortNondeterministic sorts the nondeterministic files, which are recorded
+// in the order they were hashed.
+func (ad *DebDiff) sortNondeterministic() {
+	sort.Strings(ad.nondeterministic)
+}
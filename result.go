@@ -0,0 +1,287 @@
+package debdiff
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// DiffStatus is how a differing repo file compares to the root.
+type DiffStatus int
+
+const (
+	// ContentDiffers is a file in both the repo and root with different
+	// content.
+	ContentDiffers DiffStatus = iota + 1
+	// OnlyInRepo is a repo file missing from the root.
+	OnlyInRepo
+	// OnlyInRoot is a repo file, such as a dangling symlink, whose content
+	// only exists in the root.
+	OnlyInRoot
+)
+
+func (s DiffStatus) String() string {
+	switch s {
+	case ContentDiffers:
+		return "content differs"
+	case OnlyInRepo:
+		return "only in repo"
+	case OnlyInRoot:
+		return "only in root"
+	}
+	return fmt.Sprintf("DiffStatus(%d)", int(s))
+}
+
+// RepoDiff is a repo file that differs from the root.
+type RepoDiff struct {
+	Path   string
+	Status DiffStatus
+}
+
+// Result holds the files collected by a run. The paths are relative to the
+// Root.
+type Result struct {
+	AllFile        []string
+	PkgFile        []string
+	RepoFile       []string
+	UnpackagedFile []string
+	DiffRepoFile   []string
+
+	// RepoOverlay is the overlay providing each repo file. It is not part of
+	// the binary format.
+	RepoOverlay map[string]string
+
+	// RepoDiff are the differing repo files, including those missing from
+	// the root, sorted by path. It is not part of the binary format.
+	RepoDiff []RepoDiff
+
+	// PkgOwner is the package owning each packaged file. It is not part of
+	// the binary format.
+	PkgOwner map[string]string
+}
+
+// result returns the collected files.
+func (ad *DebDiff) result() *Result {
+	return &Result{
+		AllFile:        ad.allFile,
+		PkgFile:        ad.pkgFile,
+		RepoFile:       ad.repoFile,
+		UnpackagedFile: ad.unpackagedFile,
+		DiffRepoFile:   ad.diffRepoFile,
+		RepoOverlay:    ad.repoOverlay,
+		RepoDiff:       ad.repoDiff(),
+		PkgOwner:       ad.pkgOwners(),
+	}
+}
+
+// pkgOwners returns the package owning each packaged file.
+func (ad *DebDiff) pkgOwners() map[string]string {
+	res := make(map[string]string, len(ad.pkgOwner))
+	for file, o := range ad.pkgOwner {
+		res[file] = o.Package
+	}
+	return res
+}
+
+// repoDiff returns the differing repo files with their status.
+func (ad *DebDiff) repoDiff() []RepoDiff {
+	res := make([]RepoDiff, 0, len(ad.diffRepoFile)+len(ad.repoOnlyFile))
+	for _, file := range ad.diffRepoFile {
+		status := ContentDiffers
+		if ad.rootOnly.Contains(file) {
+			status = OnlyInRoot
+		}
+		res = append(res, RepoDiff{Path: file, Status: status})
+	}
+	for _, file := range ad.repoOnlyFile {
+		res = append(res, RepoDiff{Path: file, Status: OnlyInRepo})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Path < res[j].Path })
+	return res
+}
+
+// setResult replaces the collected files with those from a previous run.
+func (ad *DebDiff) setResult(r *Result) {
+	ad.allFile = r.AllFile
+	ad.pkgFile = r.PkgFile
+	ad.repoFile = r.RepoFile
+	ad.unpackagedFile = r.UnpackagedFile
+	ad.diffRepoFile = r.DiffRepoFile
+	ad.repoOverlay = r.RepoOverlay
+}
+
+// The binary result format starts with resultMagic and the format version,
+// followed by each list as a count and the entries. Since the lists are
+// usually sorted, each entry is stored as the length of the prefix shared with
+// the previous entry and the remaining suffix. All numbers are uvarints.
+const resultVersion = 1
+
+var resultMagic = []byte("DDRS")
+
+func (r *Result) lists() []*[]string {
+	return []*[]string{
+		&r.AllFile,
+		&r.PkgFile,
+		&r.RepoFile,
+		&r.UnpackagedFile,
+		&r.DiffRepoFile,
+	}
+}
+
+type countingWriter struct {
+	w *bufio.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingWriter) uvarint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	c.Write(buf[:binary.PutUvarint(buf[:], v)])
+}
+
+// WriteTo writes the result in the binary result format.
+func (r *Result) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	cw.Write(resultMagic)
+	cw.uvarint(resultVersion)
+	for _, list := range r.lists() {
+		cw.uvarint(uint64(len(*list)))
+		var prev string
+		for _, s := range *list {
+			shared := sharedPrefix(prev, s)
+			cw.uvarint(uint64(shared))
+			cw.uvarint(uint64(len(s) - shared))
+			io.WriteString(cw, s[shared:])
+			prev = s
+		}
+	}
+	if err := cw.w.Flush(); err != nil {
+		return cw.n, errors.Wrap(err, "writing result")
+	}
+	return cw.n, nil
+}
+
+func sharedPrefix(a, b string) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// maxResultPath bounds the length of a path read from a result, so a corrupt
+// file cannot cause a huge allocation.
+const maxResultPath = 64 * 1024
+
+// ReadFrom replaces the result with one read in the binary result format.
+func (r *Result) ReadFrom(rd io.Reader) (int64, error) {
+	cr := &countingReader{r: bufio.NewReader(rd)}
+	magic := make([]byte, len(resultMagic))
+	if _, err := io.ReadFull(cr, magic); err != nil {
+		return cr.n, errors.Wrap(err, "reading result")
+	}
+	if string(magic) != string(resultMagic) {
+		return cr.n, errors.New("reading result: not a result file")
+	}
+	version, err := binary.ReadUvarint(cr)
+	if err != nil {
+		return cr.n, errors.Wrap(err, "reading result")
+	}
+	if version != resultVersion {
+		return cr.n, errors.Errorf("reading result: unknown version %d", version)
+	}
+
+	var res Result
+	for _, list := range res.lists() {
+		count, err := binary.ReadUvarint(cr)
+		if err != nil {
+			return cr.n, errors.Wrap(err, "reading result")
+		}
+		var prev []byte
+		for i := uint64(0); i < count; i++ {
+			shared, err := binary.ReadUvarint(cr)
+			if err != nil {
+				return cr.n, errors.Wrap(err, "reading result")
+			}
+			if shared > uint64(len(prev)) {
+				return cr.n, errors.New("reading result: corrupt entry")
+			}
+			suffix, err := binary.ReadUvarint(cr)
+			if err != nil {
+				return cr.n, errors.Wrap(err, "reading result")
+			}
+			if suffix > maxResultPath-shared {
+				return cr.n, errors.New("reading result: corrupt entry")
+			}
+			s := make([]byte, int(shared)+int(suffix))
+			copy(s, prev[:shared])
+			if _, err := io.ReadFull(cr, s[shared:]); err != nil {
+				return cr.n, errors.Wrap(err, "reading result")
+			}
+			*list = append(*list, string(s))
+			prev = s
+		}
+	}
+	*r = res
+	return cr.n, nil
+}
+
+func (ad *DebDiff) readResult(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "reading result")
+	}
+	defer f.Close()
+	var r Result
+	if _, err := r.ReadFrom(f); err != nil {
+		return err
+	}
+	ad.setResult(&r)
+	return nil
+}
+
+func (ad *DebDiff) writeResult(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "writing result")
+	}
+	if _, err := ad.result().WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return errors.Wrap(f.Close(), "writing result")
+}
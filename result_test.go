@@ -0,0 +1,82 @@
+package debdiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func testResult(n int) *Result {
+	r := &Result{}
+	for i := 0; i < n; i++ {
+		r.AllFile = append(r.AllFile, fmt.Sprintf("/usr/share/doc/pkg%d/file%d", i/10, i))
+	}
+	r.UnpackagedFile = r.AllFile[:n/2]
+	return r
+}
+
+func TestResultRoundTrip(t *testing.T) {
+	want := testResult(100)
+	var buf bytes.Buffer
+	if _, err := want.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var got Result
+	if _, err := got.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.AllFile, want.AllFile) ||
+		!reflect.DeepEqual(got.UnpackagedFile, want.UnpackagedFile) {
+		t.Fatal("the result read differs from the one written")
+	}
+}
+
+func TestResultCorrupt(t *testing.T) {
+	var valid bytes.Buffer
+	if _, err := testResult(10).WriteTo(&valid); err != nil {
+		t.Fatal(err)
+	}
+	entry := func(values ...uint64) []byte {
+		b := append([]byte(nil), resultMagic...)
+		b = binary.AppendUvarint(b, resultVersion)
+		for _, v := range values {
+			b = binary.AppendUvarint(b, v)
+		}
+		return b
+	}
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"bad magic", []byte("XXXX")},
+		{"truncated", valid.Bytes()[:valid.Len()-3]},
+		{"huge count", entry(1 << 62)},
+		{"huge suffix", entry(1, 0, 1<<62)},
+		{"overflowing suffix", entry(1, 0, 1<<63)},
+		{"shared beyond previous", entry(1, 5, 1)},
+	}
+	for _, c := range cases {
+		var r Result
+		if _, err := r.ReadFrom(bytes.NewReader(c.data)); err == nil {
+			t.Errorf("%s: expected an error", c.name)
+		}
+	}
+}
+
+func BenchmarkResultReadFrom(b *testing.B) {
+	var buf bytes.Buffer
+	if _, err := testResult(1000000).WriteTo(&buf); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var r Result
+		if _, err := r.ReadFrom(bytes.NewReader(buf.Bytes())); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package debdiff
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxScriptArgs bounds the bytes of arguments given to a single tar command
+// in the backup script, staying well under typical ARG_MAX limits.
+const maxScriptArgs = 32 * 1024
+
+// shellQuote quotes s for use as a single argument in a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// shellQuoteIfNeeded quotes s only if it contains characters that are special
+// to the shell.
+func shellQuoteIfNeeded(s string) string {
+	if s != "" && strings.Trim(s, shellSafe) == "" {
+		return s
+	}
+	return shellQuote(s)
+}
+
+const shellSafe = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ" +
+	"0123456789@%+=:,./-_"
+
+// writeBackupScript writes a shell script that archives the unpackaged files.
+// The files are appended to an uncompressed archive in batches, which is
+// compressed once complete.
+func (ad *DebDiff) writeBackupScript(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#!/bin/sh")
+	fmt.Fprintln(bw, "# Archives the files not owned by any package.")
+	fmt.Fprintln(bw, "set -e")
+	fmt.Fprintln(bw, `archive="${1:-backup.tgz}"`)
+	fmt.Fprintln(bw, `tmp="$archive.tar"`)
+	fmt.Fprintln(bw, `tar cf "$tmp" --files-from /dev/null`)
+
+	var size int
+	for i, file := range ad.unpackagedFile {
+		q := shellQuote(ad.rootPath(file))
+		if i == 0 || size+len(q) > maxScriptArgs {
+			if i != 0 {
+				fmt.Fprintln(bw)
+			}
+			fmt.Fprint(bw, `tar rf "$tmp" --`)
+			size = 0
+		}
+		fmt.Fprint(bw, " \\\n  ", q)
+		size += len(q) + 1
+	}
+	if len(ad.unpackagedFile) > 0 {
+		fmt.Fprintln(bw)
+	}
+
+	fmt.Fprintln(bw, `gzip -c "$tmp" > "$archive"`)
+	fmt.Fprintln(bw, `rm -f "$tmp"`)
+	return bw.Flush()
+}
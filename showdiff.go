@@ -0,0 +1,229 @@
+package debdiff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// maxShowDiffSize is the largest file that ShowDiff will diff.
+const maxShowDiffSize = 64 * 1024
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// maxDiffCells bounds the size of the table used to diff the changed lines,
+// which is quadratic in their number. Files with more changes than fit are
+// only reported as differing.
+const maxDiffCells = 4 * 1024 * 1024
+
+// isText reports if the contents look like UTF-8 text.
+func isText(b []byte) bool {
+	return bytes.IndexByte(b, 0) == -1 && utf8.Valid(b)
+}
+
+// readDiffFile reads a regular file for diffing. It returns nil if the file is
+// not a regular file, and an error if it is too large.
+func readDiffFile(path string) ([]byte, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil
+	}
+	if info.Size() > maxShowDiffSize {
+		return nil, errTooLarge
+	}
+	return ioutil.ReadFile(path)
+}
+
+var errTooLarge = errors.Errorf("larger than %d bytes", maxShowDiffSize)
+
+// writeDiffs writes a unified diff between the repo and the root for each of
+// the differing repo files.
+func (ad *DebDiff) writeDiffs(w io.Writer) {
+	for _, file := range ad.diffRepoFile {
+		if ad.rootOnly.Contains(file) {
+			continue
+		}
+		diff, err := ad.fileDiff(file)
+		if err == errTooLarge {
+			diff = fmt.Sprintf("%s: too large to diff", ad.displayRel(file))
+		} else if err != nil {
+			ad.skip(err)
+			continue
+		}
+		if diff != "" {
+			ad.emit(w, diff)
+		}
+	}
+}
+
+// fileDiff returns the unified diff for a differing repo file. It is empty if
+// either side is not a regular file.
+func (ad *DebDiff) fileDiff(file string) (string, error) {
+	repopath := ad.repoPath(file)
+	repo, err := readDiffFile(repopath)
+	if err != nil || repo == nil {
+		return "", err
+	}
+	root, err := readDiffFile(ad.rootPath(file))
+	if err != nil || root == nil {
+		return "", err
+	}
+	name := ad.displayRel(file)
+	if !isText(repo) || !isText(root) {
+		return fmt.Sprintf("%s: binary files differ", name), nil
+	}
+	ops, ok := diffLines(splitLines(string(repo)), splitLines(string(root)))
+	if !ok {
+		return fmt.Sprintf("%s: files differ, too many changes to diff", name), nil
+	}
+	var buf bytes.Buffer
+	unifiedDiff(&buf, repopath, name, ops)
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// splitLines splits s into lines, keeping the line endings.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffOp is a single line of an edit script, the kind is one of ' ', '-' or
+// '+'.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffLines returns the edit script turning a into b, based on the longest
+// common subsequence of the lines. It returns false if the lines between the
+// common prefix and suffix exceed maxDiffCells.
+func diffLines(a, b []string) ([]diffOp, bool) {
+	var prefix, suffix int
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if (len(ma)+1)*(len(mb)+1) > maxDiffCells {
+		return nil, false
+	}
+
+	// lcs[i][j] is the length of the common subsequence of ma[i:] and mb[j:]
+	lcs := make([][]int32, len(ma)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(mb)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, l := range a[:prefix] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		switch {
+		case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+			ops = append(ops, diffOp{' ', ma[i]})
+			i++
+			j++
+		case j == len(mb) || (i < len(ma) && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', ma[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', mb[j]})
+			j++
+		}
+	}
+	for _, l := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	return ops, true
+}
+
+// unifiedDiff writes the edit script from diffLines in the unified format.
+func unifiedDiff(w io.Writer, aName, bName string, ops []diffOp) {
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", aName, bName)
+
+	// the line numbers in a and b at the start of each op
+	aLine, bLine := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, op := range ops {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if op.kind != '+' {
+			aLine[i+1]++
+		}
+		if op.kind != '-' {
+			bLine[i+1]++
+		}
+	}
+
+	for start := 0; start < len(ops); {
+		if ops[start].kind == ' ' {
+			start++
+			continue
+		}
+		// extend the hunk while the changes are close enough to share context
+		end, last := start, start
+		for end < len(ops) && end-last <= 2*diffContext {
+			if ops[end].kind != ' ' {
+				last = end
+			}
+			end++
+		}
+		from := start - diffContext
+		if from < 0 {
+			from = 0
+		}
+		to := last + 1 + diffContext
+		if to > len(ops) {
+			to = len(ops)
+		}
+		fmt.Fprintf(w, "@@ -%s +%s @@\n",
+			hunkRange(aLine[from], aLine[to]-aLine[from]),
+			hunkRange(bLine[from], bLine[to]-bLine[from]))
+		for _, op := range ops[from:to] {
+			fmt.Fprintf(w, "%c%s", op.kind, op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				fmt.Fprint(w, "\n\\ No newline at end of file\n")
+			}
+		}
+		start = to
+	}
+}
+
+// hunkRange formats the range of a hunk, where start is the zero based line
+// before the hunk.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
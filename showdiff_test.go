@@ -0,0 +1,62 @@
+package debdiff
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "changed line",
+			a:    "a\nb\nc\n",
+			b:    "a\nB\nc\n",
+			want: "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name: "added line",
+			a:    "a\n",
+			b:    "a\nb\n",
+			want: "--- old\n+++ new\n@@ -1 +1,2 @@\n a\n+b\n",
+		},
+		{
+			name: "no newline at end",
+			a:    "a\n",
+			b:    "b",
+			want: "--- old\n+++ new\n@@ -1 +1 @@\n-a\n+b\n\\ No newline at end of file\n",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ops, ok := diffLines(splitLines(c.a), splitLines(c.b))
+			if !ok {
+				t.Fatal("diff too large")
+			}
+			var buf bytes.Buffer
+			unifiedDiff(&buf, "old", "new", ops)
+			if buf.String() != c.want {
+				t.Fatalf("got:\n%s\nwant:\n%s", buf.String(), c.want)
+			}
+		})
+	}
+}
+
+func TestDiffLinesTooManyChanges(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 4096; i++ {
+		a = append(a, fmt.Sprintf("a%d\n", i))
+		b = append(b, fmt.Sprintf("b%d\n", i))
+	}
+	if _, ok := diffLines(a, b); ok {
+		t.Fatal("expected the diff to be refused")
+	}
+	// a common prefix and suffix don't count towards the limit
+	if _, ok := diffLines(append(a, "x\n"), append(a, "y\n")); !ok {
+		t.Fatal("expected a diff of a single changed line")
+	}
+}
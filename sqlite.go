@@ -0,0 +1,93 @@
+package debdiff
+
+import (
+	"database/sql"
+	"os"
+
+	"github.com/pkg/errors"
+	_ "modernc.org/sqlite" // pure go sqlite driver
+)
+
+const sqliteSchema = `
+create table files (
+	path text not null,
+	category text not null,
+	owner text,
+	size integer,
+	hash text
+);
+create index files_path on files (path);
+create index files_category on files (category);
+`
+
+// categories returns the reported files for the current mode, keyed by their
+// category.
+func (ad *DebDiff) categories() map[string][]string {
+	switch ad.mode() {
+	case modeWorldWritable:
+		var files []string
+		for _, w := range ad.worldWritable {
+			files = append(files, w.Path)
+		}
+		return map[string][]string{"worldWritable": files}
+	case modeStrict:
+		return map[string][]string{"unapproved": ad.unapprovedFile}
+	}
+	return map[string][]string{
+		"unpackaged": ad.unpackagedFile,
+		"diffRepo":   ad.diffRepoFile,
+	}
+}
+
+// writeSQLite writes the results into a new sqlite database at path,
+// replacing any existing file.
+func (ad *DebDiff) writeSQLite(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "removing existing sqlite database")
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return errors.Wrap(err, "opening sqlite database")
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "starting sqlite transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(sqliteSchema); err != nil {
+		return errors.Wrap(err, "creating sqlite schema")
+	}
+	stmt, err := tx.Prepare(
+		"insert into files (path, category, owner, size, hash) " +
+			"values (?, ?, ?, ?, ?)")
+	if err != nil {
+		return errors.Wrap(err, "preparing sqlite insert")
+	}
+	defer stmt.Close()
+
+	for category, files := range ad.categories() {
+		for _, file := range files {
+			var owner, size, hash interface{}
+			if o, ok := ad.pkgOwner[file]; ok {
+				owner = o.Package
+			}
+			path := ad.rootPath(file)
+			if info, err := os.Lstat(path); err == nil {
+				size = info.Size()
+				if info.Mode().IsRegular() {
+					if h, err := ad.filehash(path); err == nil {
+						hash = h
+					}
+				}
+			}
+			if _, err := stmt.Exec(file, category, owner, size, hash); err != nil {
+				return errors.Wrap(err, "inserting into sqlite")
+			}
+		}
+	}
+
+	return errors.Wrap(tx.Commit(), "committing sqlite transaction")
+}
@@ -0,0 +1,74 @@
+package debdiff
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// summary are the totals of a diff run, printed with Summary.
+type summary struct {
+	Scanned         int   `json:"scanned"`
+	Packaged        int   `json:"packaged"`
+	Repo            int   `json:"repo"`
+	Unpackaged      int   `json:"unpackaged"`
+	Modified        int   `json:"modified"`
+	UnpackagedBytes int64 `json:"unpackaged_bytes"`
+}
+
+// unpackagedSize returns the apparent size of the unpackaged files, and the
+// number of files that could not be stat'd.
+func (ad *DebDiff) unpackagedSize() (int64, int) {
+	var total int64
+	var skipped int
+	for _, file := range ad.unpackagedFile {
+		info, err := ad.statPath(file)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				ad.skip(err)
+			}
+			skipped++
+			continue
+		}
+		if info.Mode().IsRegular() {
+			total += info.Size()
+		}
+	}
+	return total, skipped
+}
+
+// totalSizeLine is the TotalSize trailer, such as
+// "total 1.4 GiB in 20 unpackaged files".
+func (ad *DebDiff) totalSizeLine() string {
+	total, skipped := ad.unpackagedSize()
+	line := fmt.Sprintf("total %s in %d unpackaged files",
+		humanBytes(total), len(ad.unpackagedFile)-skipped)
+	if skipped > 0 {
+		line += fmt.Sprintf(", %d skipped", skipped)
+	}
+	return line
+}
+
+// summary returns the totals of the results.
+func (ad *DebDiff) summary() summary {
+	bytes, _ := ad.unpackagedSize()
+	return summary{
+		Scanned:         len(ad.allFile),
+		Packaged:        len(ad.pkgFile),
+		Repo:            len(ad.repoFile),
+		Unpackaged:      len(ad.unpackagedFile),
+		Modified:        len(ad.diffRepoFile),
+		UnpackagedBytes: bytes,
+	}
+}
+
+// write writes the summary as a block of "name: value" lines.
+func (s summary) write(w io.Writer) {
+	fmt.Fprintf(w, "scanned:          %d\n", s.Scanned)
+	fmt.Fprintf(w, "packaged:         %d\n", s.Packaged)
+	fmt.Fprintf(w, "repo:             %d\n", s.Repo)
+	fmt.Fprintf(w, "unpackaged:       %d\n", s.Unpackaged)
+	fmt.Fprintf(w, "modified:         %d\n", s.Modified)
+	fmt.Fprintf(w, "unpackaged bytes: %d (%s)\n", s.UnpackagedBytes,
+		humanBytes(s.UnpackagedBytes))
+}
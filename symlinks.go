@@ -0,0 +1,56 @@
+package debdiff
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// brokenSymlink is a walked symlink whose target does not exist.
+type brokenSymlink struct {
+	Path   string
+	Target string
+}
+
+func (b brokenSymlink) String() string {
+	return fmt.Sprintf("%s: broken symlink to %s", b.Path, b.Target)
+}
+
+// buildBrokenSymlink finds the walked symlinks whose targets don't exist.
+func (ad *DebDiff) buildBrokenSymlink(ctx context.Context) error {
+	if !ad.BrokenSymlinks {
+		return nil
+	}
+	for _, path := range ad.allFile {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		info, err := ad.statPath(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return errors.Wrap(err, "checking symlinks")
+		}
+		if !isSymlink(info) {
+			continue
+		}
+		// the target is resolved within the root
+		if _, err := statIn(ad.Root, rawPath(ad.rootRaw, path)); !os.IsNotExist(err) {
+			continue
+		}
+		raw := ad.rootPath(path)
+		target, err := os.Readlink(raw)
+		if err != nil {
+			ad.skip(err)
+			continue
+		}
+		ad.brokenSymlink = append(ad.brokenSymlink, brokenSymlink{
+			Path:   path,
+			Target: target,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package debdiff
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBrokenSymlinkInRoot(t *testing.T) {
+	ad := testDebDiff(t, map[string]string{"etc/target": "t"}, nil, "/etc")
+	ad.BrokenSymlinks = true
+	links := map[string]string{
+		"etc/abs":          "/etc/target",
+		"etc/abs-host":     "/bin/sh",
+		"etc/rel":          "target",
+		"etc/rel-missing":  "missing",
+		"etc/escape":       "../../../../etc/target",
+		"etc/chain":        "/etc/abs",
+		"etc/chain-broken": "abs-host",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(ad.Root, filepath.FromSlash(name))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ad.Run(); err != nil {
+		t.Fatal(err)
+	}
+	want := []brokenSymlink{
+		{Path: "/etc/abs-host", Target: "/bin/sh"},
+		{Path: "/etc/chain-broken", Target: "abs-host"},
+		{Path: "/etc/rel-missing", Target: "missing"},
+	}
+	if !reflect.DeepEqual(ad.brokenSymlink, want) {
+		t.Fatalf("got %v, want %v", ad.brokenSymlink, want)
+	}
+}
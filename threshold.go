@@ -0,0 +1,148 @@
+package debdiff
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// comparators are ordered so that the two character operators are tried
+// before their single character prefixes.
+var comparators = []string{"<=", ">=", "==", "!=", "<", ">"}
+
+// threshold is a single "metric comparator value" expression, such as
+// "unpackaged<=100".
+type threshold struct {
+	Metric     string
+	Comparator string
+	Value      int
+}
+
+func (t threshold) String() string {
+	return fmt.Sprintf("%s%s%d", t.Metric, t.Comparator, t.Value)
+}
+
+// Pass reports if the actual count satisfies the threshold.
+func (t threshold) Pass(actual int) bool {
+	switch t.Comparator {
+	case "<=":
+		return actual <= t.Value
+	case ">=":
+		return actual >= t.Value
+	case "==":
+		return actual == t.Value
+	case "!=":
+		return actual != t.Value
+	case "<":
+		return actual < t.Value
+	case ">":
+		return actual > t.Value
+	}
+	return false
+}
+
+// parseThresholds parses a comma separated list of threshold expressions.
+func parseThresholds(s string) ([]threshold, error) {
+	var res []threshold
+	for _, expr := range strings.Split(s, ",") {
+		expr = strings.TrimSpace(expr)
+		if expr == "" {
+			continue
+		}
+		t, err := parseThreshold(expr)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+func parseThreshold(expr string) (threshold, error) {
+	for _, c := range comparators {
+		i := strings.Index(expr, c)
+		if i == -1 {
+			continue
+		}
+		metric := strings.TrimSpace(expr[:i])
+		if _, ok := metrics[metric]; !ok {
+			return threshold{}, errors.Errorf(
+				"unknown threshold metric %q in %q", metric, expr)
+		}
+		value, err := strconv.Atoi(strings.TrimSpace(expr[i+len(c):]))
+		if err != nil {
+			return threshold{}, errors.Wrapf(err,
+				"invalid threshold value in %q", expr)
+		}
+		return threshold{Metric: metric, Comparator: c, Value: value}, nil
+	}
+	return threshold{}, errors.Errorf("invalid threshold %q", expr)
+}
+
+// metrics are the counts that thresholds can be evaluated against.
+var metrics = map[string]func(ad *DebDiff) int{
+	"all":              func(ad *DebDiff) int { return len(ad.allFile) },
+	"pkg":              func(ad *DebDiff) int { return len(ad.pkgFile) },
+	"repo":             func(ad *DebDiff) int { return len(ad.repoFile) },
+	"alternate":        func(ad *DebDiff) int { return len(ad.alternateFile) },
+	"unpackaged":       func(ad *DebDiff) int { return len(ad.unpackagedFile) },
+	"diffRepo":         func(ad *DebDiff) int { return len(ad.diffRepoFile) },
+	"modeDrift":        func(ad *DebDiff) int { return len(ad.modeDrift) },
+	"markDiff":         func(ad *DebDiff) int { return len(ad.markDiff) },
+	"worldWritable":    func(ad *DebDiff) int { return len(ad.worldWritable) },
+	"unapproved":       func(ad *DebDiff) int { return len(ad.unapprovedFile) },
+	"capsDiff":         func(ad *DebDiff) int { return len(ad.capsDiff) },
+	"altOrphan":        func(ad *DebDiff) int { return len(ad.altOrphan) },
+	"altDiff":          func(ad *DebDiff) int { return len(ad.altDiff) },
+	"nondeterministic": func(ad *DebDiff) int { return len(ad.nondeterministic) },
+	"filelessPkg":      func(ad *DebDiff) int { return len(ad.filelessPkg) },
+	"modifiedPkg":      func(ad *DebDiff) int { return len(ad.modifiedPkgFile) },
+	"missingPkg":       func(ad *DebDiff) int { return len(ad.missingPkgFile) },
+	"repoOnly":         func(ad *DebDiff) int { return len(ad.repoOnlyFile) },
+	"brokenSymlink":    func(ad *DebDiff) int { return len(ad.brokenSymlink) },
+	"repoModeDiff":     func(ad *DebDiff) int { return len(ad.repoModeDiff) },
+	"repoOwnerDiff":    func(ad *DebDiff) int { return len(ad.repoOwnerDiff) },
+	"renamed":          func(ad *DebDiff) int { return len(ad.renamedFile) },
+	"manifestDiff":     func(ad *DebDiff) int { return len(ad.manifestDiff) },
+}
+
+// ErrDifferences is returned by Main with ExitCode when there are unpackaged
+// or modified repo files, or changes since the ManifestIn manifest.
+var ErrDifferences = errors.New("differences found")
+
+// done checks the thresholds and with ExitCode, if there are differences.
+func (ad *DebDiff) done() error {
+	if err := ad.checkThresholds(); err != nil {
+		return err
+	}
+	if err := ad.collected(); err != nil {
+		return err
+	}
+	// renamed files are unpackaged files paired with a missing repo file
+	differences := len(ad.unpackagedFile) + len(ad.diffRepoFile) +
+		len(ad.renamedFile) + len(ad.manifestDiff)
+	if ad.ExitCode && differences > 0 {
+		return ErrDifferences
+	}
+	return nil
+}
+
+// checkThresholds evaluates the configured thresholds, printing the failed
+// ones to stderr and returning an error if any failed.
+func (ad *DebDiff) checkThresholds() error {
+	var failed int
+	for _, t := range ad.thresholds {
+		actual := metrics[t.Metric](ad)
+		if t.Pass(actual) {
+			continue
+		}
+		failed++
+		fmt.Fprintf(ad.stderr(), "threshold failed: %s (actual %d)\n", t, actual)
+	}
+	if failed > 0 {
+		return errors.Errorf("%d threshold(s) exceeded", failed)
+	}
+	return nil
+}
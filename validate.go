@@ -0,0 +1,157 @@
+package debdiff
+
+import (
+	"os"
+
+	"github.com/gobwas/glob"
+	"github.com/pkg/errors"
+)
+
+// usesRepo reports if the mode compares against the repo.
+func usesRepo(mode string) bool {
+	return mode == modeDiff || mode == modeStrict || mode == modeReclaimable
+}
+
+// Validate checks that the options are valid and compatible with the Mode,
+// and that the configured root, repos and ignore directory exist, so a bad
+// configuration fails before any walking begins. The zero value of an option
+// is its default.
+func (ad *DebDiff) Validate() error {
+	if err := ad.validateOptions(); err != nil {
+		return err
+	}
+	// a saved result is reported without walking
+	if ad.ResultIn != "" {
+		return nil
+	}
+	if walksRoot(ad.mode()) {
+		if err := checkDir("root", ad.Root); err != nil {
+			return err
+		}
+	}
+	if usesRepo(ad.mode()) {
+		for _, repo := range ad.repos() {
+			if err := checkDir("repo", repo); err != nil {
+				return err
+			}
+		}
+	}
+	if ad.IgnoreDir != "" && ad.IgnoreDir != "-" {
+		f, err := os.Open(ad.IgnoreDir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return errors.Errorf("ignore %s does not exist", ad.IgnoreDir)
+			}
+			return errors.Wrap(err, "invalid ignore")
+		}
+		f.Close()
+	}
+	return nil
+}
+
+// validateOptions checks the values of the options, and that they can be
+// used together.
+func (ad *DebDiff) validateOptions() error {
+	if ad.Jobs < 0 {
+		return errors.Errorf("invalid -jobs %d, must not be negative", ad.Jobs)
+	}
+	if ad.Timeout < 0 {
+		return errors.Errorf("invalid -timeout %s, must not be negative", ad.Timeout)
+	}
+	if ad.WalkOrder != "" && ad.WalkOrder != walkLexical && ad.WalkOrder != walkBFS {
+		return errors.Errorf(
+			"invalid -walk-order %q, must be lexical or bfs", ad.WalkOrder)
+	}
+	format := ad.Format
+	if format == "" {
+		format = formatText
+	}
+	if format != formatText && format != formatJSON && format != formatDebsums {
+		return errors.Errorf(
+			"invalid -format %q, must be text, json or debsums", ad.Format)
+	}
+	if ad.Relative && ad.DisplayRoot != "" {
+		return errors.New("only one of -relative and -display-root may be set")
+	}
+	if ad.Filter != "" {
+		if _, err := glob.Compile(ad.Filter); err != nil {
+			return errors.Wrapf(err, "invalid -filter %q", ad.Filter)
+		}
+	}
+	if _, ok := hashes[ad.Hash]; ad.Hash != "" && !ok {
+		return errors.Errorf(
+			"invalid -hash %q, must be md5, sha1 or sha256", ad.Hash)
+	}
+	if ad.HMACKey != "" && ad.HMACKeyFile != "" {
+		return errors.New("only one of -hmac-key and -hmac-key-file may be set")
+	}
+	switch ad.Sort {
+	case "", sortPath, sortSize, sortPackage:
+	default:
+		return errors.Errorf("invalid -sort %q, must be path, size or package", ad.Sort)
+	}
+	switch ad.Color {
+	case "", colorAuto, colorAlways, colorNever:
+	default:
+		return errors.Errorf("invalid -color %q, must be auto, always or never", ad.Color)
+	}
+	if ad.Paths != "" && ad.Paths != pathsBoth {
+		return errors.Errorf("invalid -paths %q, must be both", ad.Paths)
+	}
+
+	mode := ad.mode()
+	if ad.Strict && ad.Mode != "" && ad.Mode != modeDiff {
+		return errors.Errorf("-strict cannot be used with -mode=%s", ad.Mode)
+	}
+	// alternatives differences can also be written as json
+	altJSON := format == formatJSON && mode == modeAltDiff
+	if format != formatText && mode != modeDiff && !altJSON {
+		return errors.Errorf("-format=%s cannot be used with -mode=%s", format, mode)
+	}
+	if ad.Apply && (mode != modeDiff || ad.ResultIn != "" || ad.Daemon) {
+		return errors.New("-apply can only be used with -mode=diff on a fresh run")
+	}
+	if ad.ManifestOut != "" && (mode != modeDiff || ad.ResultIn != "" || ad.Daemon) {
+		return errors.New("-manifest-out can only be used with -mode=diff on a fresh run")
+	}
+	if ad.ManifestIn != "" && (mode != modeDiff || ad.ResultIn != "") {
+		return errors.New("-manifest-in can only be used with -mode=diff on a fresh run")
+	}
+	if ad.BackupDir != "" && !ad.Apply {
+		return errors.New("-backup-dir can only be used with -apply")
+	}
+	if ad.Summary && mode != modeDiff {
+		return errors.Errorf("-summary cannot be used with -mode=%s", mode)
+	}
+	if ad.NoWalk && walksRoot(mode) {
+		return errors.Errorf("-no-walk cannot be used with -mode=%s", mode)
+	}
+	if ad.ResultIn != "" && mode != modeDiff {
+		return errors.Errorf("-result-in cannot be used with -mode=%s", mode)
+	}
+	if ad.Daemon {
+		if ad.ResultIn != "" || ad.Explain != "" {
+			return errors.New("-daemon cannot be used with -result-in or -explain")
+		}
+		if ad.DaemonInterval <= 0 {
+			return errors.Errorf(
+				"invalid -daemon-interval %s, must be positive", ad.DaemonInterval)
+		}
+	}
+	return nil
+}
+
+// checkDir returns a descriptive error if dir is not an existing directory.
+func checkDir(what, dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errors.Errorf("%s %s does not exist", what, dir)
+		}
+		return errors.Wrapf(err, "invalid %s", what)
+	}
+	if !info.IsDir() {
+		return errors.Errorf("%s %s is not a directory", what, dir)
+	}
+	return nil
+}
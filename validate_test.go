@@ -0,0 +1,65 @@
+package debdiff
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateOptions(t *testing.T) {
+	cases := []struct {
+		ad   *DebDiff
+		want string
+	}{
+		{&DebDiff{}, ""},
+		{&DebDiff{Format: formatJSON, Mode: modeAltDiff}, ""},
+		{&DebDiff{Jobs: -1}, "invalid -jobs -1"},
+		{&DebDiff{WalkOrder: "dfs"}, "invalid -walk-order"},
+		{&DebDiff{Hash: "crc32"}, "invalid -hash"},
+		{&DebDiff{HMACKey: "a", HMACKeyFile: "b"}, "only one of -hmac-key"},
+		{&DebDiff{Strict: true, Mode: modeAltDiff}, "-strict cannot be used"},
+		{&DebDiff{Format: formatJSON, Mode: modeStrict}, "-format=json cannot be used"},
+		{&DebDiff{BackupDir: "b"}, "-backup-dir can only be used"},
+		{&DebDiff{ResultIn: "r", Mode: modeAltDiff}, "-result-in cannot be used"},
+		{&DebDiff{Daemon: true, Explain: "/etc"}, "-daemon cannot be used"},
+		{&DebDiff{Daemon: true}, "invalid -daemon-interval"},
+	}
+	for i, c := range cases {
+		err := c.ad.validateOptions()
+		if c.want == "" {
+			if err != nil {
+				t.Errorf("case %d: unexpected error %v", i, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("case %d: got error %v, want %q", i, err, c.want)
+		}
+	}
+}
+
+func TestRunResultIn(t *testing.T) {
+	ad := testDebDiff(t, map[string]string{"etc/new": "n"}, nil)
+	want, err := ad.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want.UnpackagedFile) == 0 {
+		t.Fatal("no unpackaged files to save")
+	}
+	ad.ResultIn = filepath.Join(t.TempDir(), "result")
+	if err := ad.writeResult(ad.ResultIn); err != nil {
+		t.Fatal(err)
+	}
+
+	// the saved result is read without walking the root
+	ad.Root = filepath.Join(t.TempDir(), "missing")
+	got, err := ad.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.UnpackagedFile, want.UnpackagedFile) {
+		t.Fatalf("got %v, want %v", got.UnpackagedFile, want.UnpackagedFile)
+	}
+}
@@ -0,0 +1,193 @@
+package debdiff
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// The walk orders, lexical is the depth first order used by fs.WalkDir.
+const (
+	walkLexical = "lexical"
+	walkBFS     = "bfs"
+)
+
+type walkDir struct {
+	path string // the path on disk
+	file string // the path relative to the root
+	info os.FileInfo
+}
+
+// buildAllFileCustom is the equivalent of buildAllFile but walks the root
+// itself, which allows for using the walk cache and breadth first order. The
+// final result is sorted, so is independent of the order.
+func (ad *DebDiff) buildAllFileCustom(ctx context.Context) error {
+	if ad.WalkCache != "" {
+		ad.walkPrev = ad.loadWalkCache()
+		ad.walkNext = &walkCache{
+			Version: walkCacheVersion,
+			Dirs:    make(map[string]walkCacheDir),
+		}
+	}
+	if !ad.IsIgnored("/") {
+		// a symlinked root is followed, as fs.WalkDir does
+		info, err := os.Stat(ad.Root)
+		if err != nil {
+			return errors.Wrap(err, "walking all files")
+		}
+		root := walkDir{path: ad.Root, file: "/", info: info}
+		if ad.WalkOrder == walkBFS {
+			err = ad.walkBFS(ctx, root)
+		} else {
+			err = ad.walkDFS(ctx, root)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	ad.sortStrings(ad.allFile)
+	if ad.walkNext != nil {
+		return ad.walkNext.save(ad.WalkCache)
+	}
+	return nil
+}
+
+func (ad *DebDiff) walkDFS(ctx context.Context, dir walkDir) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	subdirs, err := ad.visitDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, sub := range subdirs {
+		if err := ad.walkDFS(ctx, sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ad *DebDiff) walkBFS(ctx context.Context, root walkDir) error {
+	queue := []walkDir{root}
+	for len(queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		dir := queue[0]
+		queue = queue[1:]
+		subdirs, err := ad.visitDir(dir)
+		if err != nil {
+			return err
+		}
+		queue = append(queue, subdirs...)
+	}
+	return nil
+}
+
+// visitDir records the files in dir and returns the subdirectories to walk,
+// applying the same ignore and skip logic as buildAllFile.
+func (ad *DebDiff) visitDir(dir walkDir) ([]walkDir, error) {
+	if !dir.info.IsDir() {
+		return nil, ad.addFile(dir.file, dir.info)
+	}
+
+	entries, err := ad.listDir(dir)
+	if err != nil {
+		if os.IsPermission(errors.Cause(err)) {
+			ad.skip(err)
+			return nil, nil
+		}
+		return nil, ad.collect(err)
+	}
+
+	var subdirs []walkDir
+	for _, e := range entries {
+		path := filepath.Join(dir.path, e.Name)
+		file := filepath.Join(dir.file, e.Name)
+		if ad.IsIgnored(file) {
+			continue
+		}
+		if e.Special {
+			ad.skipSpecial(path)
+			continue
+		}
+		if !e.Dir {
+			if err := ad.collect(ad.addFile(file, nil)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// removed since the listing was cached
+				continue
+			}
+			if os.IsPermission(err) {
+				ad.skip(err)
+				continue
+			}
+			if err := ad.collect(errors.Wrap(err, "walking all files")); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if ad.skipWalkDir(path, info) {
+			continue
+		}
+		subdirs = append(subdirs, walkDir{path: path, file: file, info: info})
+	}
+	return subdirs, nil
+}
+
+// listDir returns the entries of dir, from the walk cache if it is enabled and
+// the directory is unchanged.
+func (ad *DebDiff) listDir(dir walkDir) ([]walkCacheEntry, error) {
+	if ad.walkPrev != nil {
+		cached, ok := ad.walkPrev.Dirs[dir.path]
+		if ok && cached.ModTime.Equal(dir.info.ModTime()) {
+			ad.walkNext.Dirs[dir.path] = cached
+			return cached.Entries, nil
+		}
+	}
+
+	list, err := os.ReadDir(dir.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "walking all files")
+	}
+	entries := make([]walkCacheEntry, 0, len(list))
+	for _, e := range list {
+		entries = append(entries, walkCacheEntry{
+			Name:    e.Name(),
+			Dir:     e.IsDir(),
+			Special: isSpecial(e.Type()),
+		})
+	}
+	if ad.walkNext != nil {
+		ad.walkNext.Dirs[dir.path] = walkCacheDir{
+			ModTime: dir.info.ModTime(),
+			Entries: entries,
+		}
+	}
+	return entries, nil
+}
+
+// defaultSkipDirs are the pseudo file systems that are not walked by default.
+var defaultSkipDirs = []string{"/proc", "/sys", "/dev", "/run"}
+
+// skipWalkDir reports if the directory should not be walked, either because
+// it is one of the SkipDirs or it is a mount point with OneFileSystem.
+func (ad *DebDiff) skipWalkDir(path string, info os.FileInfo) bool {
+	if ad.skipDirs.Contains(path) {
+		return true
+	}
+	if ad.rootDev != nil {
+		if dev, ok := fileDevice(info); ok && dev != *ad.rootDev {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package debdiff
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWalkSymlinkedRoot(t *testing.T) {
+	ad := testDebDiff(t,
+		map[string]string{"etc/a": "a", "etc/sub/b": "b", "usr/c": "c"},
+		nil, "/etc")
+	link := filepath.Join(t.TempDir(), "root")
+	if err := os.Symlink(ad.Root, link); err != nil {
+		t.Fatal(err)
+	}
+	ad.Root = link
+	want, err := ad.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want.AllFile) < 3 {
+		t.Fatalf("the default walk found %v", want.AllFile)
+	}
+
+	cases := []struct {
+		name      string
+		walkCache bool
+		order     string
+	}{
+		{name: "walk cache", walkCache: true},
+		{name: "lexical", walkCache: true, order: walkLexical},
+		{name: "bfs", order: walkBFS},
+		{name: "bfs walk cache", walkCache: true, order: walkBFS},
+	}
+	for _, c := range cases {
+		ad.WalkCache = ""
+		if c.walkCache {
+			ad.WalkCache = filepath.Join(t.TempDir(), "cache")
+		}
+		ad.WalkOrder = c.order
+		got, err := ad.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got.AllFile, want.AllFile) {
+			t.Errorf("%s: got %v, want %v", c.name, got.AllFile, want.AllFile)
+		}
+	}
+}
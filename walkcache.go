@@ -0,0 +1,48 @@
+package debdiff
+
+import "time"
+
+// walkCacheVersion is bumped whenever the walk cache format changes, which
+// invalidates existing caches.
+const walkCacheVersion = 2
+
+// walkCache maps directories to their entries as of a given mtime.
+//
+// A directory's mtime only changes when entries are added, removed or
+// renamed, so a cached listing only avoids re-reading directories. Changes to
+// file contents are not reflected in the mtime of the containing directory
+// and still need the hash pass to be detected.
+type walkCache struct {
+	Version int
+	Dirs    map[string]walkCacheDir
+}
+
+type walkCacheDir struct {
+	ModTime time.Time
+	Entries []walkCacheEntry
+}
+
+type walkCacheEntry struct {
+	Name    string
+	Dir     bool
+	Special bool
+}
+
+// loadWalkCache loads the cache, returning an empty one if it doesn't exist
+// or cannot be used.
+func (ad *DebDiff) loadWalkCache() *walkCache {
+	empty := &walkCache{Version: walkCacheVersion}
+	var wc walkCache
+	if !ad.loadGob(ad.WalkCache, "walk cache", &wc) {
+		return empty
+	}
+	if wc.Version != walkCacheVersion {
+		return empty
+	}
+	return &wc
+}
+
+// save atomically replaces the cache file.
+func (wc *walkCache) save(path string) error {
+	return saveGob(path, "walk cache", wc)
+}
@@ -0,0 +1,60 @@
+package debdiff
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// worldWritable is a packaged file that anyone can write to.
+type worldWritable struct {
+	Path    string
+	Mode    uint32
+	Package string
+}
+
+func (w worldWritable) String() string {
+	return fmt.Sprintf("%s %04o %s", w.Path, w.Mode, w.Package)
+}
+
+// buildWorldWritable finds packaged files that are world writable. Symlinks
+// are always 0777 and sticky directories like /tmp are writable by design,
+// so both are excluded.
+func (ad *DebDiff) buildWorldWritable(ctx context.Context) error {
+	for _, name := range ad.pkgFile {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		path := filepath.Join(ad.Root, name)
+		info, err := os.Lstat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			if os.IsPermission(err) {
+				ad.skip(err)
+				continue
+			}
+			return errors.Wrap(err, "checking world writable files")
+		}
+		mode := info.Mode()
+		if mode&os.ModeSymlink != 0 {
+			continue
+		}
+		if mode.IsDir() && mode&os.ModeSticky != 0 {
+			continue
+		}
+		if mode.Perm()&0002 == 0 {
+			continue
+		}
+		ad.worldWritable = append(ad.worldWritable, worldWritable{
+			Path:    name,
+			Mode:    unixMode(mode),
+			Package: ad.pkgOwner[name].Package,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package debdiff
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// getCapability returns the raw security.capability xattr of path, or nil if
+// it has none.
+func getCapability(path string) ([]byte, error) {
+	buf := make([]byte, 64)
+	for {
+		n, err := unix.Lgetxattr(path, "security.capability", buf)
+		switch err {
+		case nil:
+			return buf[:n], nil
+		case unix.ENODATA, unix.ENOTSUP, unix.ENOENT:
+			return nil, nil
+		case unix.ERANGE:
+			buf = make([]byte, len(buf)*2)
+			continue
+		}
+		return nil, errors.Wrapf(err, "reading capabilities of %s", path)
+	}
+}
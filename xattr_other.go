@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package debdiff
+
+// getCapability returns nil as file capabilities are only supported on linux.
+func getCapability(path string) ([]byte, error) {
+	return nil, nil
+}